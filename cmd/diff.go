@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd shows the changes the bootstrap manifests would make to the cluster.
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the changes applying the bootstrap manifests would make",
+	Run: func(cmd *cobra.Command, args []string) {
+		installMgr, err := newInstaller()
+		if err != nil {
+			logrus.Fatalf("Error creating installer: %v", err)
+		}
+		if err := installMgr.Prepare(); err != nil {
+			logrus.Fatalf("Error preparing installer: %v", err)
+		}
+		if err := installMgr.DiffBootstrapManifests(os.Stdout); err != nil {
+			logrus.Fatalf("Error diffing manifests: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// discoverCmd writes a snapshot of the discovered metadata for offline renders.
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "Discover the AWS/EKS environment and write it to the metadata file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if metadataFile == "" {
+			logrus.Fatalf("--metadata-file is required")
+		}
+		installMgr, err := newInstaller()
+		if err != nil {
+			logrus.Fatalf("Error creating installer: %v", err)
+		}
+		if err := installMgr.Discover(); err != nil {
+			logrus.Fatalf("Error discovering environment: %v", err)
+		}
+		logrus.Infof("Metadata written to %s", metadataFile)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(discoverCmd)
+}
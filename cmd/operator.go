@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/moolen/flux-poc/pkg/apis/installer/v1alpha1"
+	"github.com/moolen/flux-poc/pkg/controller"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+var operatorOpts struct {
+	metricsAddr    string
+	probeAddr      string
+	leaderElect    bool
+	resyncInterval time.Duration
+}
+
+// operatorCmd runs the installer in-cluster and reconciles Installation objects.
+var operatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "Run the installer as an operator reconciling Installation objects",
+	Long: `Run the installer as an operator reconciling Installation objects.
+
+--cluster-name is required when running in-cluster: the cluster name can not be
+discovered from the API server address of a pod, which is the ClusterIP of the
+kubernetes service and never matches the EKS endpoint.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logrus.SetLevel(logrus.DebugLevel)
+		if clusterName == "" && inCluster() {
+			logrus.Fatalf("--cluster-name is required when running in-cluster")
+		}
+		ctrl.SetLogger(logr.FromSlogHandler(slog.Default().Handler()))
+
+		scheme := runtime.NewScheme()
+		_ = clientgoscheme.AddToScheme(scheme)
+		_ = v1alpha1.AddToScheme(scheme)
+
+		mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+			Scheme:                 scheme,
+			Metrics:                metricsserver.Options{BindAddress: operatorOpts.metricsAddr},
+			HealthProbeBindAddress: operatorOpts.probeAddr,
+			LeaderElection:         operatorOpts.leaderElect,
+			LeaderElectionID:       "installer.flux-poc.io",
+		})
+		if err != nil {
+			logrus.Fatalf("Error creating manager: %v", err)
+		}
+
+		if err := (&controller.InstallationReconciler{
+			Client:         mgr.GetClient(),
+			ResyncInterval: operatorOpts.resyncInterval,
+			ClusterName:    clusterName,
+		}).SetupWithManager(mgr); err != nil {
+			logrus.Fatalf("Error setting up installation controller: %v", err)
+		}
+
+		if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+			logrus.Fatalf("Error adding health check: %v", err)
+		}
+		if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+			logrus.Fatalf("Error adding ready check: %v", err)
+		}
+
+		logrus.Infof("Starting operator")
+		if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+			logrus.Fatalf("Error running manager: %v", err)
+		}
+	},
+}
+
+// inCluster reports whether the operator uses the in-cluster config, see ctrl.GetConfig.
+func inCluster() bool {
+	return os.Getenv("KUBECONFIG") == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+func init() {
+	operatorCmd.Flags().StringVar(&operatorOpts.metricsAddr, "metrics-bind-address", ":8080", "The address the metrics endpoint binds to.")
+	operatorCmd.Flags().StringVar(&operatorOpts.probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	operatorCmd.Flags().BoolVar(&operatorOpts.leaderElect, "leader-elect", false, "Enable leader election for the operator.")
+	operatorCmd.Flags().DurationVar(&operatorOpts.resyncInterval, "resync-interval", time.Minute*10, "Interval at which installations are reconciled again.")
+	rootCmd.AddCommand(operatorCmd)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var planOutput string
+
+// planCmd prints the IAM and Vault changes the installer would make.
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the IAM and Vault changes the installer would make",
+	Run: func(cmd *cobra.Command, args []string) {
+		if planOutput != "text" && planOutput != "json" {
+			logrus.Fatalf("Unsupported output format %q, use text or json", planOutput)
+		}
+		installMgr, err := newInstaller()
+		if err != nil {
+			logrus.Fatalf("Error creating installer: %v", err)
+		}
+		if err := installMgr.Prepare(); err != nil {
+			logrus.Fatalf("Error preparing installer: %v", err)
+		}
+		p, err := installMgr.Plan()
+		if err != nil {
+			logrus.Fatalf("Error planning changes: %v", err)
+		}
+
+		if planOutput == "json" {
+			err = p.WriteJSON(os.Stdout)
+		} else {
+			err = p.WriteText(os.Stdout)
+		}
+		if err != nil {
+			logrus.Fatalf("Error writing plan: %v", err)
+		}
+	},
+}
+
+func init() {
+	planCmd.Flags().StringVarP(&planOutput, "output", "o", "text", "Output format, one of text or json.")
+	rootCmd.AddCommand(planCmd)
+}
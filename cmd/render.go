@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// renderCmd prints the bootstrap manifests. With a metadata file it runs
+// without access to the cluster or AWS.
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Print the bootstrap manifests, offline if --metadata-file is set",
+	Run: func(cmd *cobra.Command, args []string) {
+		installMgr, err := newInstaller()
+		if err != nil {
+			logrus.Fatalf("Error creating installer: %v", err)
+		}
+		if metadataFile != "" {
+			err = installMgr.PrepareOffline()
+		} else {
+			err = installMgr.Prepare()
+		}
+		if err != nil {
+			logrus.Fatalf("Error preparing installer: %v", err)
+		}
+		if err := installMgr.RenderBootstrapManifests(os.Stdout); err != nil {
+			logrus.Fatalf("Error rendering manifests: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+}
@@ -8,18 +8,36 @@ import (
 	"time"
 
 	"github.com/moolen/flux-poc/pkg/installer"
+	"github.com/moolen/flux-poc/pkg/installer/aws/awsconfig"
+	"github.com/moolen/flux-poc/pkg/installer/config"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var (
+	configFile   string
+	awsProfile   string
+	clusterName  string
+	metadataFile string
+	legacyRoles  bool
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "flux-poc",
 	Short: "",
+	Long: `Installs the platform on an EKS cluster and points Flux to the platform artifact.
+
+Objects that are no longer rendered are pruned, except the root OCIRepository
+and Kustomization of Flux: removing flux.source.url leaves them in place, run
+"flux-poc uninstall" to remove them.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		logrus.SetLevel(logrus.DebugLevel)
-		installMgr := installer.New()
+		installMgr, err := newInstaller()
+		if err != nil {
+			logrus.Fatalf("Error creating installer: %v", err)
+		}
 
 		if err := installMgr.Prepare(); err != nil {
 			logrus.Fatalf("Error preparing installer: %v", err)
@@ -53,6 +71,23 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// newInstaller creates an installer using the spec from the --config file, if any.
+func newInstaller() (*installer.Installer, error) {
+	installMgr := installer.New().
+		WithAWSOptions(awsconfig.Options{Profile: awsProfile}).
+		WithClusterName(clusterName).
+		WithMetadataFile(metadataFile).
+		WithLegacyRoleScan(legacyRoles)
+	if configFile == "" {
+		return installMgr, nil
+	}
+	spec, err := config.LoadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return installMgr.WithSpec(*spec), nil
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -63,5 +98,9 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Path to an InstallerConfig file, defaults are used if unset.")
+	rootCmd.PersistentFlags().StringVar(&awsProfile, "aws-profile", "", "AWS shared config profile, the default credential chain is used if unset.")
+	rootCmd.PersistentFlags().StringVar(&clusterName, "cluster-name", "", "Name of the EKS cluster, discovered from the kubeconfig or the API server URL if unset.")
+	rootCmd.PersistentFlags().BoolVar(&legacyRoles, "scan-legacy-roles", false, "List all IAM roles of the account to garbage collect roles of older versions removed from the config. Only needed once when migrating.")
+	rootCmd.PersistentFlags().StringVar(&metadataFile, "metadata-file", "", "Snapshot of the discovered metadata, replayed if it exists and written after discovery otherwise.")
 }
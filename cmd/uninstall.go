@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/moolen/flux-poc/pkg/installer"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var uninstallOpts installer.UninstallOptions
+
+// uninstallCmd removes everything the installer created.
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the Flux bootstrap, IRSA roles and optionally the Vault configuration",
+	Run: func(cmd *cobra.Command, args []string) {
+		logrus.SetLevel(logrus.DebugLevel)
+		installMgr, err := newInstaller()
+		if err != nil {
+			logrus.Fatalf("Error creating installer: %v", err)
+		}
+		if err := installMgr.Prepare(); err != nil {
+			logrus.Fatalf("Error preparing installer: %v", err)
+		}
+		p, err := installMgr.Uninstall(uninstallOpts)
+		if err != nil {
+			logrus.Fatalf("Error uninstalling: %v", err)
+		}
+		if p != nil {
+			if err := p.WriteText(os.Stdout); err != nil {
+				logrus.Fatalf("Error writing plan: %v", err)
+			}
+		}
+	},
+}
+
+func init() {
+	uninstallCmd.Flags().BoolVar(&uninstallOpts.KeepCRDs, "keep-crds", false, "Keep the CustomResourceDefinitions of the bootstrap manifests.")
+	uninstallCmd.Flags().BoolVar(&uninstallOpts.Vault, "vault", false, "Also remove the Kubernetes auth method and policies from Vault.")
+	uninstallCmd.Flags().BoolVar(&uninstallOpts.DryRun, "dry-run", false, "Only print the actions that would be taken.")
+	rootCmd.AddCommand(uninstallCmd)
+}
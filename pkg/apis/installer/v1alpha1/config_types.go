@@ -0,0 +1,16 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// InstallerConfigKind is the kind of the installer configuration file.
+const InstallerConfigKind = "InstallerConfig"
+
+// InstallerConfig is the schema of the configuration file passed to the CLI via --config.
+// It carries the same fields as the spec of an Installation.
+type InstallerConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	InstallationSpec `json:",inline"`
+}
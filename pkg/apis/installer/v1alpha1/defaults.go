@@ -0,0 +1,102 @@
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	DefaultInstanceID           = "default"
+	DefaultMinKubernetesVersion = "1.32.0"
+	DefaultAudience             = "sts.amazonaws.com"
+	DefaultArchitecture         = "amd64"
+	DefaultWaitTimeout          = time.Minute * 5
+	DefaultFluxInterval         = time.Minute * 10
+	DefaultFluxPath             = "./"
+)
+
+// SetDefaults fills in the defaults of unset fields.
+// Lists are only defaulted when they are omitted, an explicitly empty list is kept.
+func SetDefaults(spec *InstallationSpec) {
+	if spec.InstanceID == "" {
+		spec.InstanceID = DefaultInstanceID
+	}
+	if spec.Regions == nil {
+		spec.Regions = []string{
+			"eu-west-1",
+			"eu-west-2",
+		}
+	}
+	if spec.MinKubernetesVersion == "" {
+		spec.MinKubernetesVersion = DefaultMinKubernetesVersion
+	}
+	if spec.NodeGroups == nil {
+		spec.NodeGroups = []NodeGroupRequirement{
+			{Name: "cockroachdb", CPU: 4, MemoryGB: 16},
+			{Name: "nats", CPU: 4, MemoryGB: 16},
+			{Name: "general", CPU: 8, MemoryGB: 16},
+		}
+	}
+	for i := range spec.NodeGroups {
+		if spec.NodeGroups[i].Architecture == "" {
+			spec.NodeGroups[i].Architecture = DefaultArchitecture
+		}
+	}
+	if spec.IRSA == nil {
+		spec.IRSA = []IRSARole{
+			{
+				Name: "flux-source-controller",
+				PolicyARNs: []string{
+					"arn:${Partition}:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly",
+				},
+				ServiceAccount: "flux-system:source-controller",
+			},
+		}
+	}
+	for i := range spec.IRSA {
+		if spec.IRSA[i].Mode == "" {
+			spec.IRSA[i].Mode = IdentityModeIRSA
+		}
+		if spec.IRSA[i].Audience == "" && len(spec.IRSA[i].Audiences) == 0 {
+			spec.IRSA[i].Audience = DefaultAudience
+		}
+	}
+	setVaultDefaults(&spec.Vault)
+	if spec.Flux.Source.Path == "" {
+		spec.Flux.Source.Path = DefaultFluxPath
+	}
+	if spec.Flux.Source.Interval == nil {
+		spec.Flux.Source.Interval = &metav1.Duration{Duration: DefaultFluxInterval}
+	}
+	if spec.Bootstrap.WaitTimeout == nil {
+		spec.Bootstrap.WaitTimeout = &metav1.Duration{Duration: DefaultWaitTimeout}
+	}
+}
+
+func setVaultDefaults(vault *VaultSpec) {
+	if vault.Policies == nil {
+		vault.Policies = []VaultPolicy{
+			{
+				Name: "flux-system",
+				Policy: `
+path "secret/*" {
+  capabilities = ["read", "list"]
+}
+`,
+			},
+		}
+	}
+	if vault.Roles == nil {
+		vault.Roles = []VaultRole{
+			{
+				Name:                     "flux-system",
+				ServiceAccountNames:      []string{"flux-system"},
+				ServiceAccountNamespaces: []string{"flux-system"},
+				Policies:                 []string{"flux-system"},
+				TTL:                      "1h",
+				Period:                   "30m",
+			},
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types reported in InstallationStatus, one per installer phase.
+const (
+	ConditionPrepared            = "Prepared"
+	ConditionPrerequisitesMet    = "PrerequisitesMet"
+	ConditionInfrastructureReady = "InfrastructureReady"
+	ConditionBootstrapApplied    = "BootstrapApplied"
+	ConditionPlatformReady       = "PlatformReady"
+	ConditionReady               = "Ready"
+)
+
+// InstallationSpec describes the desired platform installation.
+type InstallationSpec struct {
+	// InstanceID distinguishes installer instances managing the same cluster.
+	// Together with the cluster name it is used to tag the AWS resources owned by the installation.
+	// +optional
+	InstanceID string `json:"instanceID,omitempty"`
+
+	// Regions is the allowlist of AWS regions the platform may be installed in.
+	// An empty list allows every region.
+	// +optional
+	Regions []string `json:"regions,omitempty"`
+
+	// MinKubernetesVersion is the minimum supported cluster version, e.g. 1.32.0.
+	// +optional
+	MinKubernetesVersion string `json:"minKubernetesVersion,omitempty"`
+
+	// AWS configures the credentials used to access AWS.
+	// +optional
+	AWS AWSSpec `json:"aws,omitempty"`
+
+	// NodeGroups lists the node groups that must exist in the cluster.
+	// +optional
+	NodeGroups []NodeGroupRequirement `json:"nodeGroups,omitempty"`
+
+	// IRSA lists the IAM roles for service accounts to provision.
+	// +optional
+	IRSA []IRSARole `json:"irsa,omitempty"`
+
+	// Vault configures the Vault policies and Kubernetes auth roles.
+	// +optional
+	Vault VaultSpec `json:"vault,omitempty"`
+
+	// Flux configures the source Flux pulls the platform workloads from.
+	// +optional
+	Flux FluxSpec `json:"flux,omitempty"`
+
+	// Bootstrap configures how the bootstrap manifests are applied.
+	// +optional
+	Bootstrap BootstrapSpec `json:"bootstrap,omitempty"`
+}
+
+// AWSSpec configures the AWS credentials. The IAM roles may live in a different
+// account than the cluster, e.g. in a central security account.
+type AWSSpec struct {
+	// AssumeRoles are assumed in order to access the account of the cluster.
+	// +optional
+	AssumeRoles []AWSAssumeRole `json:"assumeRoles,omitempty"`
+	// IAMAssumeRoles are assumed in order, starting from the ambient credentials,
+	// to access the account the IAM roles and the OIDC provider live in.
+	// The credentials of the cluster account are used if it is empty.
+	// +optional
+	IAMAssumeRoles []AWSAssumeRole `json:"iamAssumeRoles,omitempty"`
+}
+
+// AWSAssumeRole is a single hop of an assume role chain.
+type AWSAssumeRole struct {
+	// RoleARN is the ARN of the role to assume.
+	RoleARN string `json:"roleARN"`
+	// ExternalID is passed to sts:AssumeRole if set.
+	// +optional
+	ExternalID string `json:"externalID,omitempty"`
+	// SessionName of the assumed role session, defaults to flux-poc.
+	// +optional
+	SessionName string `json:"sessionName,omitempty"`
+}
+
+// BootstrapSpec configures the bootstrap apply.
+type BootstrapSpec struct {
+	// WaitTimeout is how long to wait for the applied objects to become healthy.
+	// +optional
+	WaitTimeout *metav1.Duration `json:"waitTimeout,omitempty"`
+}
+
+// NodeGroupRequirement describes the minimum size of a node group.
+type NodeGroupRequirement struct {
+	// Name is matched against the EKS and eksctl node group labels.
+	Name string `json:"name"`
+	// CPU is the minimum number of cores per node.
+	CPU int64 `json:"cpu"`
+	// MemoryGB is the minimum memory per node in GiB.
+	MemoryGB int64 `json:"memoryGB"`
+	// Architecture is the required node architecture, e.g. amd64.
+	Architecture string `json:"architecture"`
+}
+
+// IRSARole describes an IAM role assumed by a Kubernetes service account.
+type IRSARole struct {
+	// Name is appended to the cluster name to form the IAM role name.
+	Name string `json:"name"`
+	// Mode selects how the service accounts assume the role, either through the
+	// OIDC provider of the cluster (IRSA) or through EKS Pod Identity associations.
+	// +optional
+	// +kubebuilder:validation:Enum=IRSA;PodIdentity
+	Mode IdentityMode `json:"mode,omitempty"`
+	// ServiceAccount in the format namespace:serviceaccount.
+	// +optional
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// ServiceAccounts are additional service accounts allowed to assume the role,
+	// in the format namespace:serviceaccount. Entries containing * or ? are
+	// matched as patterns, e.g. tenant-*:app.
+	// +optional
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+	// Audience of the projected service account token.
+	// +optional
+	Audience string `json:"audience,omitempty"`
+	// Audiences are additional accepted audiences of the projected service account token.
+	// +optional
+	Audiences []string `json:"audiences,omitempty"`
+	// AdditionalOIDCProviderARNs are trusted in addition to the OIDC provider of
+	// the cluster, e.g. to share the role with another cluster during a migration.
+	// +optional
+	AdditionalOIDCProviderARNs []string `json:"additionalOIDCProviderARNs,omitempty"`
+	// PolicyARNs are the managed policies attached to the role. ARNs may reference
+	// ${Partition}, e.g. arn:${Partition}:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly.
+	// +optional
+	PolicyARNs []string `json:"policyARNs,omitempty"`
+	// InlinePolicyName is the name of the inline policy.
+	// Deprecated: use InlinePolicies.
+	// +optional
+	InlinePolicyName string `json:"inlinePolicyName,omitempty"`
+	// InlinePolicy is the JSON document of the inline policy.
+	// Deprecated: use InlinePolicies.
+	// +optional
+	InlinePolicy string `json:"inlinePolicy,omitempty"`
+	// InlinePolicies maps the name of an inline policy to its JSON document.
+	// Documents may reference ${AccountID}, ${Region}, ${ClusterName} and ${Partition}.
+	// +optional
+	InlinePolicies map[string]string `json:"inlinePolicies,omitempty"`
+	// Policies are customer-managed policies created by the installer and attached to the role.
+	// +optional
+	Policies []IRSAPolicy `json:"policies,omitempty"`
+	// Path is the IAM path the role is created under, the installer appends its own
+	// path segment to it. Must start and end with a slash.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// PermissionsBoundary is the ARN of the managed policy used as permissions boundary.
+	// It may reference ${AccountID} and ${Partition}.
+	// +optional
+	PermissionsBoundary string `json:"permissionsBoundary,omitempty"`
+	// MaxSessionDuration of the role, between one and twelve hours. Defaults to one hour.
+	// +optional
+	MaxSessionDuration *metav1.Duration `json:"maxSessionDuration,omitempty"`
+	// Description of the role.
+	// +optional
+	Description string `json:"description,omitempty"`
+	// Tags are added to the ownership tags of the role.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// IdentityMode selects how workloads assume an IAM role.
+type IdentityMode string
+
+const (
+	IdentityModeIRSA        IdentityMode = "IRSA"
+	IdentityModePodIdentity IdentityMode = "PodIdentity"
+)
+
+// IRSAPolicy is a customer-managed IAM policy.
+type IRSAPolicy struct {
+	// Name is appended to the role name to form the policy name.
+	Name string `json:"name"`
+	// Document is the JSON policy document.
+	// It may reference ${AccountID}, ${Region}, ${ClusterName} and ${Partition}.
+	Document string `json:"document"`
+	// Description of the policy, it can not be changed once the policy is created.
+	// +optional
+	Description string `json:"description,omitempty"`
+}
+
+// VaultSpec describes the Vault configuration managed by the installer.
+type VaultSpec struct {
+	// Address of the Vault server. Defaults to the vault service in the
+	// vault namespace, using the discovered cluster DNS domain.
+	// +optional
+	Address string `json:"address,omitempty"`
+	// Policies are the Vault ACL policies to write.
+	// +optional
+	Policies []VaultPolicy `json:"policies,omitempty"`
+	// Roles are the Kubernetes auth roles to write.
+	// +optional
+	Roles []VaultRole `json:"roles,omitempty"`
+}
+
+// VaultPolicy is a named Vault ACL policy.
+type VaultPolicy struct {
+	Name   string `json:"name"`
+	Policy string `json:"policy"`
+}
+
+// VaultRole is a Vault Kubernetes auth role.
+type VaultRole struct {
+	Name                     string   `json:"name"`
+	ServiceAccountNames      []string `json:"serviceAccountNames"`
+	ServiceAccountNamespaces []string `json:"serviceAccountNamespaces"`
+	Policies                 []string `json:"policies"`
+	// +optional
+	TTL string `json:"ttl,omitempty"`
+	// +optional
+	Period string `json:"period,omitempty"`
+}
+
+// FluxSpec describes how Flux is bootstrapped.
+type FluxSpec struct {
+	// Source is the OCI repository holding the platform workloads.
+	// +optional
+	Source FluxSource `json:"source,omitempty"`
+}
+
+// FluxSource points to the OCI artifact holding the platform workloads.
+// An OCIRepository and a root Kustomization are rendered for it if the URL is set.
+type FluxSource struct {
+	// URL of the OCI repository, e.g. oci://123456789012.dkr.ecr.eu-west-1.amazonaws.com/platform.
+	// +optional
+	URL string `json:"url,omitempty"`
+	// Tag of the artifact to pull.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+	// Semver range of the artifact to pull, takes precedence over Tag.
+	// +optional
+	Semver string `json:"semver,omitempty"`
+	// Path within the artifact that is applied by the root Kustomization.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Interval at which the source and the root Kustomization are reconciled.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// InstallationStatus reports the progress of the installer phases.
+type InstallationStatus struct {
+	// ObservedGeneration is the last generation that was reconciled.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions holds one condition per installer phase.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Installation is the Schema for the installations API.
+type Installation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InstallationSpec   `json:"spec,omitempty"`
+	Status InstallationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// InstallationList contains a list of Installation.
+type InstallationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Installation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Installation{}, &InstallationList{})
+}
@@ -0,0 +1,237 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var (
+	versionRegexp = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+	regionRegexp  = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+	// instanceIDRegexp matches valid AWS tag values
+	instanceIDRegexp  = regexp.MustCompile(`^[\w.:/=+@-]{1,256}$`)
+	sessionNameRegexp = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+	supportedArchitectures = sets.New("amd64", "arm64")
+	supportedIdentityModes = sets.New(IdentityModeIRSA, IdentityModePodIdentity)
+	// reservedTagKeys are the ownership tags set by the installer
+	reservedTagKeys = sets.New("flux-poc.io/cluster", "flux-poc.io/instance", "kubernetes.io/cluster/flux-poc")
+)
+
+// Validate validates a defaulted spec. Every error carries the path of the offending field,
+// fields that are left for SetDefaults are reported as required.
+func Validate(spec *InstallationSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if !instanceIDRegexp.MatchString(spec.InstanceID) {
+		errs = append(errs, field.Invalid(fldPath.Child("instanceID"), spec.InstanceID, "must be a valid AWS tag value"))
+	}
+	for i, region := range spec.Regions {
+		if !regionRegexp.MatchString(region) {
+			errs = append(errs, field.Invalid(fldPath.Child("regions").Index(i), region, "must be an AWS region, e.g. eu-west-1"))
+		}
+	}
+	if !versionRegexp.MatchString(spec.MinKubernetesVersion) {
+		errs = append(errs, field.Invalid(fldPath.Child("minKubernetesVersion"), spec.MinKubernetesVersion, "must be in the format major.minor.patch"))
+	}
+
+	errs = append(errs, validateAssumeRoles(spec.AWS.AssumeRoles, fldPath.Child("aws", "assumeRoles"))...)
+	errs = append(errs, validateAssumeRoles(spec.AWS.IAMAssumeRoles, fldPath.Child("aws", "iamAssumeRoles"))...)
+
+	nodeGroupNames := sets.New[string]()
+	for i, ng := range spec.NodeGroups {
+		idxPath := fldPath.Child("nodeGroups").Index(i)
+		if ng.Name == "" {
+			errs = append(errs, field.Required(idxPath.Child("name"), ""))
+		} else if nodeGroupNames.Has(ng.Name) {
+			errs = append(errs, field.Duplicate(idxPath.Child("name"), ng.Name))
+		}
+		nodeGroupNames.Insert(ng.Name)
+		if ng.CPU <= 0 {
+			errs = append(errs, field.Invalid(idxPath.Child("cpu"), ng.CPU, "must be greater than zero"))
+		}
+		if ng.MemoryGB <= 0 {
+			errs = append(errs, field.Invalid(idxPath.Child("memoryGB"), ng.MemoryGB, "must be greater than zero"))
+		}
+		if !supportedArchitectures.Has(ng.Architecture) {
+			errs = append(errs, field.NotSupported(idxPath.Child("architecture"), ng.Architecture, sets.List(supportedArchitectures)))
+		}
+	}
+
+	roleNames := sets.New[string]()
+	for i, role := range spec.IRSA {
+		idxPath := fldPath.Child("irsa").Index(i)
+		if role.Name == "" {
+			errs = append(errs, field.Required(idxPath.Child("name"), ""))
+		} else if roleNames.Has(role.Name) {
+			errs = append(errs, field.Duplicate(idxPath.Child("name"), role.Name))
+		}
+		roleNames.Insert(role.Name)
+		if role.ServiceAccount == "" && len(role.ServiceAccounts) == 0 {
+			errs = append(errs, field.Required(idxPath.Child("serviceAccount"), "serviceAccount or serviceAccounts must be set"))
+		} else if role.ServiceAccount != "" {
+			errs = append(errs, validateServiceAccount(role.ServiceAccount, idxPath.Child("serviceAccount"))...)
+		}
+		for j, sa := range role.ServiceAccounts {
+			errs = append(errs, validateServiceAccount(sa, idxPath.Child("serviceAccounts").Index(j))...)
+		}
+		if !supportedIdentityModes.Has(role.Mode) {
+			errs = append(errs, field.NotSupported(idxPath.Child("mode"), role.Mode, sets.List(supportedIdentityModes)))
+		}
+		if role.Mode == IdentityModePodIdentity {
+			// pod identity associations bind exactly one service account
+			for j, sa := range role.ServiceAccounts {
+				if strings.ContainsAny(sa, "*?") {
+					errs = append(errs, field.Invalid(idxPath.Child("serviceAccounts").Index(j), sa, "patterns are not supported with mode PodIdentity"))
+				}
+			}
+			if strings.ContainsAny(role.ServiceAccount, "*?") {
+				errs = append(errs, field.Invalid(idxPath.Child("serviceAccount"), role.ServiceAccount, "patterns are not supported with mode PodIdentity"))
+			}
+			if len(role.AdditionalOIDCProviderARNs) > 0 {
+				errs = append(errs, field.Forbidden(idxPath.Child("additionalOIDCProviderARNs"), "not supported with mode PodIdentity"))
+			}
+		}
+		for j, arn := range role.AdditionalOIDCProviderARNs {
+			if !strings.HasPrefix(arn, "arn:") || !strings.Contains(arn, ":oidc-provider/") {
+				errs = append(errs, field.Invalid(idxPath.Child("additionalOIDCProviderARNs").Index(j), arn, "must be an IAM OIDC provider ARN"))
+			}
+		}
+		for j, arn := range role.PolicyARNs {
+			if !strings.HasPrefix(arn, "arn:") {
+				errs = append(errs, field.Invalid(idxPath.Child("policyARNs").Index(j), arn, "must be an IAM policy ARN"))
+			}
+		}
+		if (role.InlinePolicyName == "") != (role.InlinePolicy == "") {
+			errs = append(errs, field.Invalid(idxPath.Child("inlinePolicy"), role.InlinePolicy, "inlinePolicyName and inlinePolicy must be set together"))
+		} else if role.InlinePolicy != "" && !json.Valid([]byte(role.InlinePolicy)) {
+			errs = append(errs, field.Invalid(idxPath.Child("inlinePolicy"), role.InlinePolicy, "must be a JSON policy document"))
+		}
+		if _, ok := role.InlinePolicies[role.InlinePolicyName]; ok && role.InlinePolicyName != "" {
+			errs = append(errs, field.Duplicate(idxPath.Child("inlinePolicies").Key(role.InlinePolicyName), role.InlinePolicyName))
+		}
+		for name, doc := range role.InlinePolicies {
+			if !json.Valid([]byte(doc)) {
+				errs = append(errs, field.Invalid(idxPath.Child("inlinePolicies").Key(name), doc, "must be a JSON policy document"))
+			}
+		}
+		policyNames := sets.New[string]()
+		for j, policy := range role.Policies {
+			policyPath := idxPath.Child("policies").Index(j)
+			if policy.Name == "" {
+				errs = append(errs, field.Required(policyPath.Child("name"), ""))
+			} else if policyNames.Has(policy.Name) {
+				errs = append(errs, field.Duplicate(policyPath.Child("name"), policy.Name))
+			}
+			policyNames.Insert(policy.Name)
+			if !json.Valid([]byte(policy.Document)) {
+				errs = append(errs, field.Invalid(policyPath.Child("document"), policy.Document, "must be a JSON policy document"))
+			}
+		}
+		if role.Path != "" && (!strings.HasPrefix(role.Path, "/") || !strings.HasSuffix(role.Path, "/")) {
+			errs = append(errs, field.Invalid(idxPath.Child("path"), role.Path, "must start and end with /"))
+		}
+		if role.PermissionsBoundary != "" && !strings.HasPrefix(role.PermissionsBoundary, "arn:") {
+			errs = append(errs, field.Invalid(idxPath.Child("permissionsBoundary"), role.PermissionsBoundary, "must be an IAM policy ARN"))
+		}
+		if d := role.MaxSessionDuration; d != nil && (d.Duration < time.Hour || d.Duration > 12*time.Hour || d.Duration%time.Second != 0) {
+			errs = append(errs, field.Invalid(idxPath.Child("maxSessionDuration"), d.Duration.String(), "must be whole seconds between 1h and 12h"))
+		}
+		for k, v := range role.Tags {
+			if strings.HasPrefix(strings.ToLower(k), "aws:") || reservedTagKeys.Has(k) {
+				errs = append(errs, field.Invalid(idxPath.Child("tags").Key(k), k, "tag key is reserved"))
+			} else if v != "" && !instanceIDRegexp.MatchString(v) {
+				errs = append(errs, field.Invalid(idxPath.Child("tags").Key(k), v, "must be a valid AWS tag value"))
+			}
+		}
+	}
+
+	errs = append(errs, validateVault(&spec.Vault, fldPath.Child("vault"))...)
+	errs = append(errs, validateFluxSource(&spec.Flux.Source, fldPath.Child("flux", "source"))...)
+	if spec.Bootstrap.WaitTimeout == nil {
+		errs = append(errs, field.Required(fldPath.Child("bootstrap", "waitTimeout"), ""))
+	} else if spec.Bootstrap.WaitTimeout.Duration <= 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("bootstrap", "waitTimeout"), spec.Bootstrap.WaitTimeout.Duration.String(), "must be greater than zero"))
+	}
+	return errs
+}
+
+func validateAssumeRoles(roles []AWSAssumeRole, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, role := range roles {
+		idxPath := fldPath.Index(i)
+		if !strings.HasPrefix(role.RoleARN, "arn:") || !strings.Contains(role.RoleARN, ":role/") {
+			errs = append(errs, field.Invalid(idxPath.Child("roleARN"), role.RoleARN, "must be an IAM role ARN"))
+		}
+		if role.SessionName != "" && !sessionNameRegexp.MatchString(role.SessionName) {
+			errs = append(errs, field.Invalid(idxPath.Child("sessionName"), role.SessionName, "must be a valid role session name"))
+		}
+	}
+	return errs
+}
+
+func validateServiceAccount(sa string, fldPath *field.Path) field.ErrorList {
+	parts := strings.Split(sa, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return field.ErrorList{field.Invalid(fldPath, sa, "must be in the format namespace:serviceaccount")}
+	}
+	return nil
+}
+
+func validateVault(vault *VaultSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if u, err := url.Parse(vault.Address); vault.Address != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+		errs = append(errs, field.Invalid(fldPath.Child("address"), vault.Address, "must be an absolute URL"))
+	}
+
+	policyNames := sets.New[string]()
+	for i, policy := range vault.Policies {
+		idxPath := fldPath.Child("policies").Index(i)
+		if policy.Name == "" {
+			errs = append(errs, field.Required(idxPath.Child("name"), ""))
+		} else if policyNames.Has(policy.Name) {
+			errs = append(errs, field.Duplicate(idxPath.Child("name"), policy.Name))
+		}
+		policyNames.Insert(policy.Name)
+		if policy.Policy == "" {
+			errs = append(errs, field.Required(idxPath.Child("policy"), ""))
+		}
+	}
+
+	roleNames := sets.New[string]()
+	for i, role := range vault.Roles {
+		idxPath := fldPath.Child("roles").Index(i)
+		if role.Name == "" {
+			errs = append(errs, field.Required(idxPath.Child("name"), ""))
+		} else if roleNames.Has(role.Name) {
+			errs = append(errs, field.Duplicate(idxPath.Child("name"), role.Name))
+		}
+		roleNames.Insert(role.Name)
+		if len(role.ServiceAccountNames) == 0 {
+			errs = append(errs, field.Required(idxPath.Child("serviceAccountNames"), ""))
+		}
+		if len(role.ServiceAccountNamespaces) == 0 {
+			errs = append(errs, field.Required(idxPath.Child("serviceAccountNamespaces"), ""))
+		}
+	}
+	return errs
+}
+
+func validateFluxSource(source *FluxSource, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if source.URL != "" && !strings.HasPrefix(source.URL, "oci://") {
+		errs = append(errs, field.Invalid(fldPath.Child("url"), source.URL, "must start with oci://"))
+	}
+	if source.Interval == nil {
+		errs = append(errs, field.Required(fldPath.Child("interval"), ""))
+	} else if source.Interval.Duration <= 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("interval"), source.Interval.Duration.String(), "must be greater than zero"))
+	}
+	return errs
+}
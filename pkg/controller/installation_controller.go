@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/moolen/flux-poc/pkg/apis/installer/v1alpha1"
+	"github.com/moolen/flux-poc/pkg/installer"
+	"github.com/sirupsen/logrus"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const infrastructureRetryInterval = time.Second * 5
+
+// phaseConditions are the conditions of the installer phases in the order they run.
+var phaseConditions = []string{
+	v1alpha1.ConditionPrepared,
+	v1alpha1.ConditionPrerequisitesMet,
+	v1alpha1.ConditionInfrastructureReady,
+	v1alpha1.ConditionBootstrapApplied,
+	v1alpha1.ConditionPlatformReady,
+}
+
+// InstallationReconciler drives an Installation through the installer phases
+// and records the outcome of each phase as a status condition.
+type InstallationReconciler struct {
+	client.Client
+
+	// ResyncInterval is the interval at which a successful installation is reconciled again.
+	ResyncInterval time.Duration
+	// ClusterName of the EKS cluster, discovered if empty. Discovery fails in-cluster,
+	// as the API server address of a pod never matches the EKS endpoint.
+	ClusterName string
+}
+
+func (r *InstallationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.Installation{}).
+		Complete(r)
+}
+
+func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var inst v1alpha1.Installation
+	if err := r.Get(ctx, req.NamespacedName, &inst); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !inst.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	// the installer phases take minutes, the status is patched so that changes
+	// made to the object in the meantime do not cause a conflict
+	orig := inst.DeepCopy()
+
+	logrus.Debugf("Reconciling installation %s", inst.Name)
+	result, reconcileErr := r.reconcile(&inst)
+
+	inst.Status.ObservedGeneration = inst.Generation
+	if err := r.Status().Patch(ctx, &inst, client.MergeFrom(orig)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("updating installation status: %w", err)
+	}
+	return result, reconcileErr
+}
+
+func (r *InstallationReconciler) reconcile(inst *v1alpha1.Installation) (ctrl.Result, error) {
+	spec := inst.Spec.DeepCopy()
+	v1alpha1.SetDefaults(spec)
+	if errs := v1alpha1.Validate(spec, field.NewPath("spec")); len(errs) > 0 {
+		markFalse(inst, v1alpha1.ConditionPrepared, "InvalidSpec", errs.ToAggregate())
+		// an invalid spec is not retried until the object changes
+		return ctrl.Result{}, nil
+	}
+	installMgr := installer.New().WithSpec(*spec).WithClusterName(r.ClusterName)
+
+	if err := installMgr.Prepare(); err != nil {
+		markFalse(inst, v1alpha1.ConditionPrepared, "PrepareFailed", err)
+		return ctrl.Result{}, err
+	}
+	markTrue(inst, v1alpha1.ConditionPrepared)
+
+	// prerequisite failures are reported but do not block the installation,
+	// which mirrors the behaviour of the CLI.
+	if err := installMgr.CheckPrerequisites(); err != nil {
+		logrus.Warnf("Prerequisite checks failed: %v", err)
+		apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+			Type:               v1alpha1.ConditionPrerequisitesMet,
+			Status:             metav1.ConditionFalse,
+			Reason:             "PrerequisitesNotMet",
+			Message:            err.Error(),
+			ObservedGeneration: inst.Generation,
+		})
+	} else {
+		markTrue(inst, v1alpha1.ConditionPrerequisitesMet)
+	}
+
+	retry, err := installMgr.ReconcileInfrastructure()
+	if retry {
+		markFalse(inst, v1alpha1.ConditionInfrastructureReady, "Progressing", fmt.Errorf("infrastructure is not ready yet: %v", err))
+		return ctrl.Result{RequeueAfter: infrastructureRetryInterval}, nil
+	}
+	if err != nil {
+		markFalse(inst, v1alpha1.ConditionInfrastructureReady, "InfrastructureFailed", err)
+		return ctrl.Result{}, err
+	}
+	markTrue(inst, v1alpha1.ConditionInfrastructureReady)
+
+	if err := installMgr.ApplyBootstrapManifests(); err != nil {
+		markFalse(inst, v1alpha1.ConditionBootstrapApplied, "ApplyFailed", err)
+		return ctrl.Result{}, err
+	}
+	markTrue(inst, v1alpha1.ConditionBootstrapApplied)
+
+	if err := installMgr.ReconcilePlatform(); err != nil {
+		markFalse(inst, v1alpha1.ConditionPlatformReady, "PlatformFailed", err)
+		return ctrl.Result{}, err
+	}
+	markTrue(inst, v1alpha1.ConditionPlatformReady)
+	markTrue(inst, v1alpha1.ConditionReady)
+
+	return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+}
+
+func markTrue(inst *v1alpha1.Installation, conditionType string) {
+	apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Succeeded",
+		ObservedGeneration: inst.Generation,
+	})
+}
+
+// markFalse marks the phase condition as failed and the installation as not ready.
+// The conditions of the later phases are reset to Unknown, as they did not run.
+func markFalse(inst *v1alpha1.Installation, conditionType, reason string, err error) {
+	apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            err.Error(),
+		ObservedGeneration: inst.Generation,
+	})
+	for _, later := range laterPhases(conditionType) {
+		apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+			Type:               later,
+			Status:             metav1.ConditionUnknown,
+			Reason:             "Blocked",
+			Message:            fmt.Sprintf("waiting for %s", conditionType),
+			ObservedGeneration: inst.Generation,
+		})
+	}
+	apimeta.SetStatusCondition(&inst.Status.Conditions, metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            fmt.Sprintf("%s: %s", conditionType, err.Error()),
+		ObservedGeneration: inst.Generation,
+	})
+}
+
+// laterPhases returns the conditions of the phases running after the given one.
+func laterPhases(conditionType string) []string {
+	for i, phase := range phaseConditions {
+		if phase == conditionType {
+			return phaseConditions[i+1:]
+		}
+	}
+	return nil
+}
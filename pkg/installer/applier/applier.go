@@ -0,0 +1,162 @@
+package applier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FieldManager is the field manager used for server-side apply.
+const FieldManager = "custom-applier"
+
+// Applier applies rendered manifests with server-side apply.
+// Objects of types unknown to the client-go scheme, e.g. Flux or External Secrets
+// custom resources, are applied as unstructured objects.
+type Applier struct {
+	client  client.Client
+	scheme  *runtime.Scheme
+	mapper  *restmapper.DeferredDiscoveryRESTMapper
+	decoder runtime.Decoder
+}
+
+// New creates an Applier for the cluster behind the given REST config.
+func New(restConfig *rest.Config) (*Applier, error) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = apiextensionsv1.AddToScheme(scheme)
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %w", err)
+	}
+	// the mapper caches discovery results, it is reset after the CRD wave
+	// so that the kinds defined by the CRDs can be resolved in the same run.
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+
+	cl, err := client.New(restConfig, client.Options{Scheme: scheme, Mapper: mapper})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	return &Applier{
+		client:  cl,
+		scheme:  scheme,
+		mapper:  mapper,
+		decoder: serializer.NewCodecFactory(scheme).UniversalDeserializer(),
+	}, nil
+}
+
+// Apply decodes the multi-document YAML and applies the objects in waves:
+// CRDs and Namespaces, cluster-scoped RBAC, namespaced workloads and finally custom resources.
+// It returns references to all applied objects.
+func (a *Applier) Apply(ctx context.Context, yamlData []byte) ([]ObjectRef, error) {
+	objs, err := a.Decode(yamlData)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []ObjectRef
+	for _, w := range a.sortIntoWaves(objs) {
+		if len(w.objects) == 0 {
+			continue
+		}
+		// the references are taken before applying, as the server response
+		// may clear the type information of typed objects
+		for _, obj := range w.objects {
+			refs = append(refs, refFor(obj))
+		}
+		logrus.Debugf("Applying wave %s with %d objects", w.name, len(w.objects))
+		if err := a.applyWave(ctx, w); err != nil {
+			return nil, fmt.Errorf("wave %s failed: %w", w.name, err)
+		}
+	}
+	return refs, nil
+}
+
+func (a *Applier) applyObject(ctx context.Context, obj client.Object) error {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	logrus.Debugf("Applying %s %s/%s", gvk.Kind, obj.GetNamespace(), obj.GetName())
+	err := a.client.Patch(ctx, obj, client.Apply, &client.PatchOptions{
+		Force:        ptr.To(true),
+		FieldManager: FieldManager,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply %s %s/%s: %w",
+			gvk.Kind, obj.GetNamespace(), obj.GetName(), err)
+	}
+	return nil
+}
+
+// Decode splits the multi-document YAML into objects. Types known to the scheme
+// are decoded into typed objects, all others into unstructured objects.
+func (a *Applier) Decode(yamlData []byte) ([]client.Object, error) {
+	var objs []client.Object
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(yamlData), 4096)
+	for {
+		raw := map[string]interface{}{}
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to decode YAML: %w", err)
+		}
+		if len(raw) == 0 {
+			continue // skip empty docs
+		}
+
+		objJSON, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal raw object: %w", err)
+		}
+
+		obj, err := a.decodeObject(objJSON)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+func (a *Applier) decodeObject(objJSON []byte) (client.Object, error) {
+	obj, _, err := a.decoder.Decode(objJSON, nil, nil)
+	if runtime.IsNotRegisteredError(err) {
+		u := &unstructured.Unstructured{}
+		if err := u.UnmarshalJSON(objJSON); err != nil {
+			return nil, fmt.Errorf("failed to decode unstructured object: %w", err)
+		}
+		return u, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode typed object: %w", err)
+	}
+
+	// assert client.Object
+	cObj, ok := obj.(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("decoded object is not a client.Object: %T", obj)
+	}
+	return cObj, nil
+}
+
+func isCRD(obj client.Object) bool {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	return gvk.Group == apiextensionsv1.GroupName && gvk.Kind == "CustomResourceDefinition"
+}
@@ -0,0 +1,143 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/moolen/flux-poc/pkg/installer/plan"
+	"github.com/sirupsen/logrus"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	deletePollInterval = time.Second * 2
+	deleteTimeout      = time.Minute * 5
+)
+
+// Suspend sets spec.suspend on a Flux object, so that its controller stops reconciling it.
+// Suspended Flux objects are deleted without garbage collecting the objects they applied.
+func (a *Applier) Suspend(ctx context.Context, ref ObjectRef, p *plan.Plan) error {
+	live, err := a.getLive(ctx, ref)
+	if err != nil || live == nil {
+		return err
+	}
+	return p.Do(plan.Action{
+		Type:     plan.SuspendObject,
+		Resource: plan.ResourceKubernetes,
+		Name:     ref.String(),
+	}, func() error {
+		logrus.Debugf("Suspending %s", ref)
+		patch := client.RawPatch(types.MergePatchType, []byte(`{"spec":{"suspend":true}}`))
+		if err := a.client.Patch(ctx, live, patch); err != nil {
+			return fmt.Errorf("failed to suspend %s: %w", ref, err)
+		}
+		return nil
+	})
+}
+
+// Delete deletes the objects and waits until they are gone.
+// Objects annotated with installer.flux-poc.io/prune=disabled are kept.
+// With a non-nil plan the deletions are only recorded.
+func (a *Applier) Delete(ctx context.Context, refs []ObjectRef, p *plan.Plan) error {
+	return a.deleteObjects(ctx, refs, p, false)
+}
+
+// ForceDelete deletes the objects like Delete, including objects annotated with
+// installer.flux-poc.io/prune=disabled.
+func (a *Applier) ForceDelete(ctx context.Context, refs []ObjectRef, p *plan.Plan) error {
+	return a.deleteObjects(ctx, refs, p, true)
+}
+
+func (a *Applier) deleteObjects(ctx context.Context, refs []ObjectRef, p *plan.Plan, force bool) error {
+	var deleted []ObjectRef
+	for _, ref := range refs {
+		live, err := a.getLive(ctx, ref)
+		if err != nil {
+			return err
+		}
+		if live == nil {
+			continue
+		}
+		if !force && live.GetAnnotations()[PruneAnnotation] == PruneDisabled {
+			logrus.Debugf("Skipping deletion of %s, pruning is disabled", ref)
+			continue
+		}
+		err = p.Do(plan.Action{
+			Type:     plan.DeleteObject,
+			Resource: plan.ResourceKubernetes,
+			Name:     ref.String(),
+		}, func() error {
+			logrus.Debugf("Deleting %s", ref)
+			err := a.client.Delete(ctx, live, client.PropagationPolicy(metav1.DeletePropagationBackground))
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete %s: %w", ref, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		deleted = append(deleted, ref)
+	}
+	if p != nil || len(deleted) == 0 {
+		return nil
+	}
+
+	err := wait.PollUntilContextTimeout(ctx, deletePollInterval, deleteTimeout, true, func(ctx context.Context) (bool, error) {
+		for _, ref := range deleted {
+			live, err := a.getLive(ctx, ref)
+			if err != nil || live != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for %d objects to be deleted: %w", len(deleted), err)
+	}
+	return nil
+}
+
+// DeleteInventory deletes every object recorded in the inventory, wave by wave in
+// reverse apply order, and finally the inventory itself. CRDs are kept if keepCRDs is set.
+func (a *Applier) DeleteInventory(ctx context.Context, keepCRDs bool, p *plan.Plan) error {
+	refs, err := a.Inventory(ctx)
+	if err != nil {
+		return err
+	}
+
+	waves := make([][]ObjectRef, len(waveNames))
+	for _, ref := range refs {
+		if keepCRDs && isCRDRef(ref) {
+			continue
+		}
+		idx := a.waveForRef(ref)
+		waves[idx] = append(waves[idx], ref)
+	}
+	for idx := len(waves) - 1; idx >= 0; idx-- {
+		if len(waves[idx]) == 0 {
+			continue
+		}
+		logrus.Debugf("Deleting wave %s with %d objects", waveNames[idx], len(waves[idx]))
+		if err := a.Delete(ctx, waves[idx], p); err != nil {
+			return fmt.Errorf("wave %s failed: %w", waveNames[idx], err)
+		}
+	}
+
+	return a.Delete(ctx, []ObjectRef{{
+		GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+		Namespace:        InventoryNamespace,
+		Name:             InventoryName,
+	}}, p)
+}
+
+func isCRDRef(ref ObjectRef) bool {
+	return ref.Group == apiextensionsv1.GroupName && ref.Kind == "CustomResourceDefinition"
+}
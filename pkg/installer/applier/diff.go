@@ -0,0 +1,218 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	maskedValue       = "***"
+	maskedValueBefore = "*** (before)"
+	maskedValueAfter  = "*** (after)"
+)
+
+// Diff writes a unified diff per object between the live state and the state after
+// applying the manifests, computed with a server-side dry-run apply. Objects that would
+// be pruned are shown as deletions. Secret values are masked. It returns the number of
+// objects that would change.
+func (a *Applier) Diff(ctx context.Context, yamlData []byte, w io.Writer) (int, error) {
+	objs, err := a.Decode(yamlData)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	var refs []ObjectRef
+	for _, wv := range a.sortIntoWaves(objs) {
+		for _, obj := range wv.objects {
+			ref := refFor(obj)
+			refs = append(refs, ref)
+
+			live, err := a.getLive(ctx, ref)
+			if err != nil {
+				return changed, err
+			}
+			merged, err := a.dryRunApply(ctx, obj)
+			if err != nil {
+				return changed, fmt.Errorf("failed to dry-run %s: %w", ref, err)
+			}
+			ok, err := writeDiff(w, ref, live, merged)
+			if err != nil {
+				return changed, err
+			}
+			if ok {
+				changed++
+			}
+		}
+	}
+
+	stale, err := a.staleRefs(ctx, refs)
+	if err != nil {
+		return changed, err
+	}
+	for _, ref := range stale {
+		live, err := a.getLive(ctx, ref)
+		if err != nil {
+			return changed, err
+		}
+		if live == nil || live.GetAnnotations()[PruneAnnotation] == PruneDisabled {
+			continue
+		}
+		ok, err := writeDiff(w, ref, live, nil)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+func (a *Applier) getLive(ctx context.Context, ref ObjectRef) (*unstructured.Unstructured, error) {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(ref.GroupVersionKind)
+	err := a.client.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, u)
+	if apierrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", ref, err)
+	}
+	return u, nil
+}
+
+// dryRunApply returns the object as it would be persisted by a server-side apply.
+// Custom resources whose CRD is not installed yet and objects whose namespace
+// does not exist yet can not be dry-run, the rendered object is returned instead.
+func (a *Applier) dryRunApply(ctx context.Context, obj client.Object) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	rendered := u.DeepCopy()
+
+	err = a.client.Patch(ctx, u, client.Apply, client.DryRunAll, &client.PatchOptions{
+		Force:        ptr.To(true),
+		FieldManager: FieldManager,
+	})
+	if apimeta.IsNoMatchError(err) {
+		logrus.Debugf("Kind %s is not installed yet, showing rendered object", rendered.GroupVersionKind())
+		return rendered, nil
+	}
+	if apierrors.IsNotFound(err) {
+		logrus.Debugf("Namespace %s does not exist yet, showing rendered %s", rendered.GetNamespace(), rendered.GroupVersionKind())
+		return rendered, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// writeDiff writes the diff between live and merged, either of them may be nil.
+// It reports whether the objects differ.
+func writeDiff(w io.Writer, ref ObjectRef, live, merged *unstructured.Unstructured) (bool, error) {
+	live, merged = cleanForDiff(live), cleanForDiff(merged)
+	if ref.Group == "" && ref.Kind == "Secret" {
+		maskSecretData(live, merged)
+	}
+
+	from, err := toYAML(live)
+	if err != nil {
+		return false, err
+	}
+	to, err := toYAML(merged)
+	if err != nil {
+		return false, err
+	}
+	if from == to {
+		return false, nil
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: "live/" + ref.String(),
+		ToFile:   "merged/" + ref.String(),
+		Context:  3,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to diff %s: %w", ref, err)
+	}
+	_, err = fmt.Fprint(w, diff)
+	return true, err
+}
+
+// cleanForDiff drops fields that are managed by the server and only add noise to the diff.
+func cleanForDiff(u *unstructured.Unstructured) *unstructured.Unstructured {
+	if u == nil {
+		return nil
+	}
+	u = u.DeepCopy()
+	for _, f := range [][]string{
+		{"metadata", "managedFields"},
+		{"metadata", "resourceVersion"},
+		{"metadata", "generation"},
+		{"metadata", "uid"},
+		{"metadata", "creationTimestamp"},
+		{"status"},
+	} {
+		unstructured.RemoveNestedField(u.Object, f...)
+	}
+	return u
+}
+
+// maskSecretData replaces all secret values, marking the values that change.
+func maskSecretData(live, merged *unstructured.Unstructured) {
+	for _, field := range []string{"data", "stringData"} {
+		var before, after map[string]interface{}
+		if live != nil {
+			before, _, _ = unstructured.NestedMap(live.Object, field)
+		}
+		if merged != nil {
+			after, _, _ = unstructured.NestedMap(merged.Object, field)
+		}
+		for k, v := range before {
+			if av, ok := after[k]; ok && av != v {
+				before[k], after[k] = maskedValueBefore, maskedValueAfter
+				continue
+			}
+			before[k] = maskedValue
+		}
+		for k, v := range after {
+			if v != maskedValueAfter {
+				after[k] = maskedValue
+			}
+		}
+		if before != nil {
+			_ = unstructured.SetNestedMap(live.Object, before, field)
+		}
+		if after != nil {
+			_ = unstructured.SetNestedMap(merged.Object, after, field)
+		}
+	}
+}
+
+func toYAML(u *unstructured.Unstructured) (string, error) {
+	if u == nil {
+		return "", nil
+	}
+	out, err := yaml.Marshal(u.Object)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s: %w", u.GetName(), err)
+	}
+	return string(out), nil
+}
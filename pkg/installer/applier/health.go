@@ -0,0 +1,184 @@
+package applier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const healthPollInterval = time.Second * 5
+
+// ObjectRef identifies an applied object.
+type ObjectRef struct {
+	schema.GroupVersionKind
+	Namespace string
+	Name      string
+}
+
+func refFor(obj client.Object) ObjectRef {
+	return ObjectRef{
+		GroupVersionKind: obj.GetObjectKind().GroupVersionKind(),
+		Namespace:        obj.GetNamespace(),
+		Name:             obj.GetName(),
+	}
+}
+
+func (r ObjectRef) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// healthStatus is the result of evaluating the health of a single object.
+type healthStatus struct {
+	healthy bool
+	status  string
+	message string
+}
+
+// WaitForHealthy polls the objects until all of them are healthy or the timeout expires.
+// Deployments must be available, CRDs established and objects that report
+// a Ready condition, e.g. Flux and External Secrets resources, must be ready.
+// On timeout the returned error contains a table of the unhealthy objects.
+func (a *Applier) WaitForHealthy(ctx context.Context, refs []ObjectRef, timeout time.Duration) error {
+	pending := map[ObjectRef]healthStatus{}
+	for _, ref := range refs {
+		pending[ref] = healthStatus{status: "Unknown"}
+	}
+
+	logrus.Debugf("Waiting up to %s for %d objects to become healthy", timeout, len(refs))
+	err := wait.PollUntilContextTimeout(ctx, healthPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		for ref := range pending {
+			hs, err := a.checkHealth(ctx, ref)
+			if err != nil {
+				hs = healthStatus{status: "Error", message: err.Error()}
+			}
+			if hs.healthy {
+				delete(pending, ref)
+				continue
+			}
+			pending[ref] = hs
+		}
+		return len(pending) == 0, nil
+	})
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%d objects not healthy after %s:\n%s", len(pending), timeout, healthTable(pending))
+}
+
+func (a *Applier) checkHealth(ctx context.Context, ref ObjectRef) (healthStatus, error) {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(ref.GroupVersionKind)
+	if err := a.client.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, u); err != nil {
+		if apierrors.IsNotFound(err) {
+			return healthStatus{status: "NotFound", message: "object does not exist"}, nil
+		}
+		return healthStatus{}, err
+	}
+	return evaluateHealth(u), nil
+}
+
+// evaluateHealth computes the health of an object from its status, similar to kstatus.
+// Objects without a known readiness signal are considered healthy.
+func evaluateHealth(u *unstructured.Unstructured) healthStatus {
+	observed, found, _ := unstructured.NestedInt64(u.Object, "status", "observedGeneration")
+	if found && observed < u.GetGeneration() {
+		return healthStatus{status: "InProgress", message: "status is not observed yet"}
+	}
+
+	gvk := u.GroupVersionKind()
+	switch {
+	case gvk.Group == "apps" && gvk.Kind == "Deployment":
+		return deploymentHealth(u)
+	case gvk.Group == "apiextensions.k8s.io" && gvk.Kind == "CustomResourceDefinition":
+		return conditionHealth(u, "Established")
+	}
+
+	if _, ok := findCondition(u, "Ready"); ok {
+		return conditionHealth(u, "Ready")
+	}
+	return healthStatus{healthy: true, status: "Current"}
+}
+
+func deploymentHealth(u *unstructured.Unstructured) healthStatus {
+	replicas, found, _ := unstructured.NestedInt64(u.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	updated, _, _ := unstructured.NestedInt64(u.Object, "status", "updatedReplicas")
+	available, _, _ := unstructured.NestedInt64(u.Object, "status", "availableReplicas")
+
+	hs := conditionHealth(u, "Available")
+	if !hs.healthy {
+		if cond, ok := findCondition(u, "Progressing"); ok && hs.message == "" {
+			hs.message = cond["message"]
+		}
+		return hs
+	}
+	if updated < replicas || available < replicas {
+		return healthStatus{
+			status:  "InProgress",
+			message: fmt.Sprintf("%d/%d replicas updated, %d available", updated, replicas, available),
+		}
+	}
+	return hs
+}
+
+func conditionHealth(u *unstructured.Unstructured, conditionType string) healthStatus {
+	cond, ok := findCondition(u, conditionType)
+	if !ok {
+		return healthStatus{status: "InProgress", message: fmt.Sprintf("%s condition not reported yet", conditionType)}
+	}
+	if cond["status"] == "True" {
+		return healthStatus{healthy: true, status: "Current", message: cond["message"]}
+	}
+	return healthStatus{status: conditionType + "=" + cond["status"], message: cond["message"]}
+}
+
+func findCondition(u *unstructured.Unstructured, conditionType string) (map[string]string, bool) {
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok || cond["type"] != conditionType {
+			continue
+		}
+		res := map[string]string{}
+		for _, key := range []string{"type", "status", "reason", "message"} {
+			if v, ok := cond[key].(string); ok {
+				res[key] = v
+			}
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+func healthTable(objs map[ObjectRef]healthStatus) string {
+	refs := make([]ObjectRef, 0, len(objs))
+	for ref := range objs {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tSTATUS\tMESSAGE")
+	for _, ref := range refs {
+		hs := objs[ref]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", ref.Kind, ref.Namespace, ref.Name, hs.status, hs.message)
+	}
+	_ = w.Flush()
+	return buf.String()
+}
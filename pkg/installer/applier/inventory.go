@@ -0,0 +1,177 @@
+package applier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// InventoryName is the name of the ConfigMap that records the applied objects.
+	InventoryName = "flux-poc-inventory"
+	// InventoryNamespace is the namespace of the inventory ConfigMap.
+	InventoryNamespace = "flux-system"
+
+	// PruneAnnotation opts an object out of pruning when set to PruneDisabled.
+	PruneAnnotation = "installer.flux-poc.io/prune"
+	PruneDisabled   = "disabled"
+
+	inventoryKey = "objects"
+)
+
+// inventoryEntry is the serialized form of an ObjectRef, modelled after the Flux inventory.
+// The ID has the format <namespace>_<name>_<group>_<kind>.
+type inventoryEntry struct {
+	ID      string `json:"id"`
+	Version string `json:"v"`
+}
+
+func (r ObjectRef) id() string {
+	return strings.Join([]string{r.Namespace, r.Name, r.Group, r.Kind}, "_")
+}
+
+func refFromEntry(e inventoryEntry) (ObjectRef, error) {
+	parts := strings.Split(e.ID, "_")
+	if len(parts) != 4 {
+		return ObjectRef{}, fmt.Errorf("invalid inventory entry %q", e.ID)
+	}
+	return ObjectRef{
+		GroupVersionKind: schema.GroupVersionKind{Group: parts[2], Version: e.Version, Kind: parts[3]},
+		Namespace:        parts[0],
+		Name:             parts[1],
+	}, nil
+}
+
+// Inventory returns the objects recorded by the last successful apply.
+func (a *Applier) Inventory(ctx context.Context) ([]ObjectRef, error) {
+	cm := &corev1.ConfigMap{}
+	err := a.client.Get(ctx, client.ObjectKey{Namespace: InventoryNamespace, Name: InventoryName}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory: %w", err)
+	}
+
+	var entries []inventoryEntry
+	if err := json.Unmarshal([]byte(cm.Data[inventoryKey]), &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode inventory: %w", err)
+	}
+	refs := make([]ObjectRef, 0, len(entries))
+	for _, e := range entries {
+		ref, err := refFromEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// Prune deletes the objects of the previous inventory that are not part of refs
+// and records refs as the new inventory. Objects annotated with
+// installer.flux-poc.io/prune=disabled are kept.
+func (a *Applier) Prune(ctx context.Context, refs []ObjectRef) error {
+	stale, err := a.staleRefs(ctx, refs)
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("Found %d objects to prune", len(stale))
+	for _, ref := range stale {
+		if err := a.pruneObject(ctx, ref); err != nil {
+			return err
+		}
+	}
+
+	return a.writeInventory(ctx, refs)
+}
+
+// staleRefs returns the objects of the inventory that are not part of refs,
+// in reverse wave order so that CRDs and Namespaces come last.
+func (a *Applier) staleRefs(ctx context.Context, refs []ObjectRef) ([]ObjectRef, error) {
+	previous, err := a.Inventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]struct{}, len(refs))
+	for _, ref := range refs {
+		current[ref.id()] = struct{}{}
+	}
+	var stale []ObjectRef
+	for _, ref := range previous {
+		if _, ok := current[ref.id()]; !ok {
+			stale = append(stale, ref)
+		}
+	}
+	sort.SliceStable(stale, func(i, j int) bool {
+		return a.waveForRef(stale[i]) > a.waveForRef(stale[j])
+	})
+	return stale, nil
+}
+
+func (a *Applier) pruneObject(ctx context.Context, ref ObjectRef) error {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(ref.GroupVersionKind)
+	err := a.client.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, u)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", ref, err)
+	}
+	if u.GetAnnotations()[PruneAnnotation] == PruneDisabled {
+		logrus.Debugf("Skipping prune of %s, pruning is disabled", ref)
+		return nil
+	}
+
+	logrus.Debugf("Pruning %s", ref)
+	err = a.client.Delete(ctx, u, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to prune %s: %w", ref, err)
+	}
+	return nil
+}
+
+func (a *Applier) writeInventory(ctx context.Context, refs []ObjectRef) error {
+	entries := make([]inventoryEntry, 0, len(refs))
+	for _, ref := range refs {
+		entries = append(entries, inventoryEntry{ID: ref.id(), Version: ref.Version})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode inventory: %w", err)
+	}
+
+	cm := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: InventoryName, Namespace: InventoryNamespace},
+		Data:       map[string]string{inventoryKey: string(data)},
+	}
+	err = a.client.Patch(ctx, cm, client.Apply, &client.PatchOptions{
+		Force:        ptr.To(true),
+		FieldManager: FieldManager,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write inventory: %w", err)
+	}
+	return nil
+}
+
+func (a *Applier) waveForRef(ref ObjectRef) int {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(ref.GroupVersionKind)
+	return a.waveFor(u)
+}
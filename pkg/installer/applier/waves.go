@@ -0,0 +1,112 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	crdPollInterval     = time.Second * 2
+	crdEstablishTimeout = time.Minute
+)
+
+// wave is a group of objects that are applied together.
+// Waves are applied in order, so that objects never race ahead of their dependencies.
+type wave struct {
+	name    string
+	objects []client.Object
+}
+
+const (
+	waveCRDsAndNamespaces = iota
+	waveClusterRBAC
+	waveWorkloads
+	waveCustomResources
+)
+
+var waveNames = []string{
+	waveCRDsAndNamespaces: "crds-and-namespaces",
+	waveClusterRBAC:       "cluster-rbac",
+	waveWorkloads:         "workloads",
+	waveCustomResources:   "custom-resources",
+}
+
+// sortIntoWaves groups the objects into waves, keeping the rendered order within a wave.
+func (a *Applier) sortIntoWaves(objs []client.Object) []wave {
+	waves := make([]wave, len(waveNames))
+	for i, name := range waveNames {
+		waves[i].name = name
+	}
+	for _, obj := range objs {
+		idx := a.waveFor(obj)
+		waves[idx].objects = append(waves[idx].objects, obj)
+	}
+	return waves
+}
+
+func (a *Applier) waveFor(obj client.Object) int {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	switch {
+	case isCRD(obj), gvk.Group == "" && gvk.Kind == "Namespace":
+		return waveCRDsAndNamespaces
+	case gvk.Group == rbacv1.GroupName && (gvk.Kind == "ClusterRole" || gvk.Kind == "ClusterRoleBinding"):
+		return waveClusterRBAC
+	case !a.scheme.Recognizes(gvk):
+		return waveCustomResources
+	default:
+		return waveWorkloads
+	}
+}
+
+// applyWave applies all objects of the wave and waits for CRDs to be established.
+func (a *Applier) applyWave(ctx context.Context, w wave) error {
+	var crds []client.Object
+	for _, obj := range w.objects {
+		if isCRD(obj) {
+			crds = append(crds, obj)
+		}
+		if err := a.applyObject(ctx, obj); err != nil {
+			return err
+		}
+	}
+	if len(crds) == 0 {
+		return nil
+	}
+
+	for _, crd := range crds {
+		if err := a.waitForEstablished(ctx, crd.GetName()); err != nil {
+			return err
+		}
+	}
+	// the kinds defined by the CRDs must be resolvable by the following waves
+	logrus.Debugf("Refreshing REST mapper after applying %d CRDs", len(crds))
+	a.mapper.Reset()
+	return nil
+}
+
+func (a *Applier) waitForEstablished(ctx context.Context, name string) error {
+	logrus.Debugf("Waiting for CRD %s to be established", name)
+	err := wait.PollUntilContextTimeout(ctx, crdPollInterval, crdEstablishTimeout, true, func(ctx context.Context) (bool, error) {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := a.client.Get(ctx, client.ObjectKey{Name: name}, crd); err != nil {
+			return false, err
+		}
+		for _, cond := range crd.Status.Conditions {
+			if cond.Type == apiextensionsv1.Established && cond.Status == apiextensionsv1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("CRD %s is not established: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package awsconfig
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// DefaultSessionName is used for assumed roles without a session name.
+const DefaultSessionName = "flux-poc"
+
+// AssumeRole is a single hop of an assume role chain.
+type AssumeRole struct {
+	RoleARN     string
+	ExternalID  string
+	SessionName string
+}
+
+// Options configures how the AWS credentials of the installer are resolved.
+type Options struct {
+	// Profile is the shared config profile of the base credentials.
+	// The default credential chain is used if it is empty.
+	Profile string
+	// AssumeRoles are assumed in order, starting from the base credentials,
+	// to access the account of the EKS cluster.
+	AssumeRoles []AssumeRole
+	// IAMAssumeRoles are assumed in order, starting from the base credentials,
+	// to access the account the IAM roles are created in. The credentials of
+	// the EKS account are used if it is empty.
+	IAMAssumeRoles []AssumeRole
+}
+
+// Config holds the AWS configs shared by all AWS clients of the installer.
+type Config struct {
+	// EKS accesses the account of the EKS cluster.
+	EKS aws.Config
+	// IAM accesses the account the IAM roles, policies and the OIDC provider live in.
+	IAM aws.Config
+}
+
+// Load resolves the base credentials and assumes the configured role chains.
+// Credentials are only retrieved when the first request is made.
+func Load(ctx context.Context, opts Options) (*Config, error) {
+	var loadOpts []func(*config.LoadOptions) error
+	if opts.Profile != "" {
+		loadOpts = append(loadOpts, config.WithSharedConfigProfile(opts.Profile))
+	}
+	base, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if base.Region == "" {
+		return nil, fmt.Errorf("AWS region not found in config")
+	}
+
+	eksConfig := assumeChain(base, opts.AssumeRoles)
+	iamConfig := eksConfig
+	if len(opts.IAMAssumeRoles) > 0 {
+		iamConfig = assumeChain(base, opts.IAMAssumeRoles)
+	}
+	return &Config{
+		EKS: eksConfig,
+		IAM: iamConfig,
+	}, nil
+}
+
+// FromConfig uses the same config for the EKS and the IAM account.
+func FromConfig(cfg aws.Config) *Config {
+	return &Config{EKS: cfg, IAM: cfg}
+}
+
+// assumeChain returns a copy of the config that assumes the roles in order,
+// each role is assumed with the credentials of the previous one.
+func assumeChain(cfg aws.Config, roles []AssumeRole) aws.Config {
+	for _, role := range roles {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), role.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = role.SessionName
+			if o.RoleSessionName == "" {
+				o.RoleSessionName = DefaultSessionName
+			}
+			if role.ExternalID != "" {
+				o.ExternalID = aws.String(role.ExternalID)
+			}
+		})
+		cfg = cfg.Copy()
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg
+}
@@ -0,0 +1,124 @@
+package irsa
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// policyEqual reports whether the policy document returned by IAM is semantically
+// equal to the desired document. Only the current document is URL-decoded, as IAM
+// returns documents percent-encoded while the desired document may contain a literal "%".
+func policyEqual(current, desired string) (bool, error) {
+	// PathUnescape is used as it keeps "+" as is.
+	decoded, err := url.PathUnescape(current)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode policy document: %w", err)
+	}
+	nc, err := normalizePolicy(decoded)
+	if err != nil {
+		return false, err
+	}
+	nd, err := normalizePolicy(desired)
+	if err != nil {
+		return false, err
+	}
+	return nc == nd, nil
+}
+
+// normalizePolicy returns the canonical JSON encoding of a policy document.
+// Object keys are sorted and the statements as well as the values of Action,
+// NotAction, Resource, NotResource, Principal and Condition are compared as sets:
+// they are sorted and deduplicated and single element lists are replaced by their
+// element, so that "Action": "s3:GetObject" and "Action": ["s3:GetObject"] as well
+// as a single statement object and a list of one statement compare equal.
+func normalizePolicy(doc string) (string, error) {
+	var policy map[string]interface{}
+	if err := json.Unmarshal([]byte(doc), &policy); err != nil {
+		return "", fmt.Errorf("failed to parse policy document: %w", err)
+	}
+	if statements, ok := policy["Statement"]; ok {
+		policy["Statement"] = normalizeStatements(statements)
+	}
+	b, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// normalizeStatements normalizes every statement, the order of statements does not matter.
+func normalizeStatements(v interface{}) interface{} {
+	statements, ok := v.([]interface{})
+	if !ok {
+		statements = []interface{}{v}
+	}
+	for _, statement := range statements {
+		if s, ok := statement.(map[string]interface{}); ok {
+			normalizeStatement(s)
+		}
+	}
+	return canonicalSet(statements)
+}
+
+func normalizeStatement(statement map[string]interface{}) {
+	for key, val := range statement {
+		switch key {
+		case "Action", "NotAction", "Resource", "NotResource":
+			statement[key] = canonicalSet(val)
+		case "Principal", "NotPrincipal":
+			// either "*" or a map of principal type to principals
+			if principals, ok := val.(map[string]interface{}); ok {
+				for typ, ids := range principals {
+					principals[typ] = canonicalSet(ids)
+				}
+			}
+		case "Condition":
+			// operator to condition key to values
+			operators, ok := val.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, conditions := range operators {
+				if keys, ok := conditions.(map[string]interface{}); ok {
+					for k, values := range keys {
+						keys[k] = canonicalSet(values)
+					}
+				}
+			}
+		}
+	}
+}
+
+// canonicalSet sorts and deduplicates a list and replaces a single element list by its
+// element. Values that are not lists are returned as is.
+func canonicalSet(v interface{}) interface{} {
+	list, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+	seen := map[string]struct{}{}
+	var keys []string
+	values := map[string]interface{}{}
+	for _, val := range list {
+		// json.Marshal sorts map keys, so the encoding is canonical
+		b, _ := json.Marshal(val)
+		key := string(b)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+		values[key] = val
+	}
+	if len(keys) == 1 {
+		return values[keys[0]]
+	}
+	sort.Strings(keys)
+	out := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, values[key])
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package irsa
+
+import "testing"
+
+func TestPolicyEqual(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		desired string
+		equal   bool
+	}{
+		{
+			name:    "URL-encoded current document",
+			current: `%7B%22Version%22%3A%222012-10-17%22%2C%22Statement%22%3A%5B%7B%22Effect%22%3A%22Allow%22%2C%22Action%22%3A%22s3%3AGetObject%22%2C%22Resource%22%3A%22%2A%22%7D%5D%7D`,
+			desired: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`,
+			equal:   true,
+		},
+		{
+			name:    "literal percent in desired document",
+			current: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::bucket/a%25b"}]}`,
+			desired: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::bucket/a%b"}]}`,
+			equal:   true,
+		},
+		{
+			name:    "scalar and single element list",
+			current: `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["*"]}}`,
+			desired: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`,
+			equal:   true,
+		},
+		{
+			name: "reordered statements",
+			current: `{"Version":"2012-10-17","Statement":[` +
+				`{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"},` +
+				`{"Effect":"Deny","Action":"s3:DeleteObject","Resource":"*"}]}`,
+			desired: `{"Version":"2012-10-17","Statement":[` +
+				`{"Effect":"Deny","Action":"s3:DeleteObject","Resource":"*"},` +
+				`{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`,
+			equal: true,
+		},
+		{
+			name:    "reordered actions and resources",
+			current: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:PutObject","s3:GetObject"],"Resource":["arn:aws:s3:::b/*","arn:aws:s3:::a/*"]}]}`,
+			desired: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":["arn:aws:s3:::a/*","arn:aws:s3:::b/*"]}]}`,
+			equal:   true,
+		},
+		{
+			name:    "reordered principals and condition values",
+			current: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::2:root","arn:aws:iam::1:root"]},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"aws:PrincipalTag/team":["b","a"]}}}]}`,
+			desired: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::1:root","arn:aws:iam::2:root"]},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"aws:PrincipalTag/team":["a","b"]}}}]}`,
+			equal:   true,
+		},
+		{
+			name:    "different actions",
+			current: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":"*"}]}`,
+			desired: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`,
+			equal:   false,
+		},
+		{
+			name:    "different effect",
+			current: `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"s3:GetObject","Resource":"*"}]}`,
+			desired: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`,
+			equal:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			equal, err := policyEqual(tt.current, tt.desired)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if equal != tt.equal {
+				t.Errorf("policyEqual() = %v, want %v", equal, tt.equal)
+			}
+		})
+	}
+}
@@ -2,69 +2,348 @@ package irsa
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/moolen/flux-poc/pkg/installer/plan"
 	"github.com/sirupsen/logrus"
 )
 
+// GarbageCollect deletes owned roles and customer-managed policies that are not in the
+// desired set. They are looked up under the owner path below "/" and below the base path
+// of every desired role, roles below a base path that is no longer configured are not found.
+// Roles created by older versions directly under "/" are only found with WithLegacyRoleScan.
 func (m *Manager) GarbageCollect(ctx context.Context, desired []IRSAConfig) error {
+	return m.collect(ctx, desired, desired)
+}
+
+// DeleteAll deletes all roles and policies owned by the manager's owner. The configured roles
+// are only used to determine the paths, role names and OIDC providers to look for owned roles.
+func (m *Manager) DeleteAll(ctx context.Context, roles []IRSAConfig) error {
+	return m.collect(ctx, nil, roles)
+}
+
+// collect deletes the owned roles and policies found for the configured roles that are
+// not desired. Roles of configured names directly under "/" are looked up by name.
+func (m *Manager) collect(ctx context.Context, desired, configured []IRSAConfig) error {
 	desiredSet := make(map[string]struct{})
+	desiredPolicies := make(map[string]struct{})
 	for _, cfg := range desired {
 		desiredSet[cfg.RoleName] = struct{}{}
+		for _, policy := range cfg.Policies {
+			policyArn, err := m.policyARN(cfg, policy)
+			if err != nil {
+				return err
+			}
+			desiredPolicies[policyArn] = struct{}{}
+		}
 	}
 
-	roles, err := m.listTaggedRoles(ctx)
+	paths := map[string]struct{}{m.owner.Path(): {}}
+	providers := map[string]struct{}{}
+	var rootNames []string
+	for _, cfg := range configured {
+		for _, providerArn := range cfg.OIDCProviderArns {
+			providers[providerArn] = struct{}{}
+		}
+		paths[m.rolePath(cfg)] = struct{}{}
+		if _, exists := desiredSet[cfg.RoleName]; !exists {
+			rootNames = append(rootNames, cfg.RoleName)
+		}
+	}
+
+	var roles []types.Role
+	var err error
+	if m.scanLegacyRoles {
+		roles, err = m.listRootRoles(ctx, providers)
+	} else {
+		roles, err = m.getRootRoles(ctx, rootNames, providers)
+	}
 	if err != nil {
 		return err
 	}
+	for path := range paths {
+		owned, err := m.listOwnedRoles(ctx, path)
+		if err != nil {
+			return err
+		}
+		roles = append(roles, owned...)
+	}
 
-	logrus.Debugf("Found %d roles with tag %s=%s", len(roles), ClusterTagKey, ClusterTagValue)
+	logrus.Debugf("Found %d roles owned by %s", len(roles), m.owner)
 	for _, role := range roles {
 		if _, exists := desiredSet[*role.RoleName]; !exists {
 			logrus.Debugf("Deleting role %s as it is not in the desired set", *role.RoleName)
-			_, err := m.client.DeleteRole(ctx, &iam.DeleteRoleInput{
+			if err := m.deleteRole(ctx, *role.RoleName); err != nil {
+				return err
+			}
+		}
+	}
+
+	for path := range paths {
+		policies, err := m.listOwnedPolicies(ctx, path)
+		if err != nil {
+			return err
+		}
+		for _, policyArn := range policies {
+			if _, exists := desiredPolicies[policyArn]; !exists {
+				logrus.Debugf("Deleting policy %s as it is not in the desired set", policyArn)
+				if err := m.deletePolicy(ctx, policyArn); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteRole detaches all managed policies, deletes all inline policies and removes the
+// role from its instance profiles before deleting it, as IAM refuses to delete roles
+// that are still in use.
+func (m *Manager) deleteRole(ctx context.Context, roleName string) error {
+	attached, err := m.listAttachedPolicies(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	for policyArn := range attached {
+		if err := m.detachPolicy(ctx, roleName, policyArn); err != nil {
+			return err
+		}
+	}
+
+	inline, err := m.listInlinePolicies(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	for _, policyName := range inline {
+		if err := m.deleteInlinePolicy(ctx, roleName, policyName); err != nil {
+			return err
+		}
+	}
+
+	profiles, err := m.listInstanceProfiles(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	for _, profileName := range profiles {
+		err := m.plan.Do(plan.Action{
+			Type:     plan.RemoveFromInstanceProfile,
+			Resource: plan.ResourceIAMRole,
+			Name:     roleName,
+			Detail:   profileName,
+		}, func() error {
+			_, err := m.client.RemoveRoleFromInstanceProfile(ctx, &iam.RemoveRoleFromInstanceProfileInput{
+				InstanceProfileName: aws.String(profileName),
+				RoleName:            aws.String(roleName),
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove role %s from instance profile %s: %w", roleName, profileName, err)
+		}
+	}
+
+	err = m.plan.Do(plan.Action{
+		Type:     plan.DeleteRole,
+		Resource: plan.ResourceIAMRole,
+		Name:     roleName,
+	}, func() error {
+		_, err := m.client.DeleteRole(ctx, &iam.DeleteRoleInput{
+			RoleName: aws.String(roleName),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete role %s: %w", roleName, err)
+	}
+	return nil
+}
+
+func (m *Manager) detachPolicy(ctx context.Context, roleName, policyArn string) error {
+	err := m.plan.Do(plan.Action{
+		Type:     plan.DetachPolicy,
+		Resource: plan.ResourceIAMRole,
+		Name:     roleName,
+		Detail:   policyArn,
+	}, func() error {
+		_, err := m.client.DetachRolePolicy(ctx, &iam.DetachRolePolicyInput{
+			PolicyArn: aws.String(policyArn),
+			RoleName:  aws.String(roleName),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to detach policy %s from role %s: %w", policyArn, roleName, err)
+	}
+	return nil
+}
+
+func (m *Manager) deleteInlinePolicy(ctx context.Context, roleName, policyName string) error {
+	err := m.plan.Do(plan.Action{
+		Type:     plan.DeleteInlinePolicy,
+		Resource: plan.ResourceIAMRole,
+		Name:     roleName,
+		Detail:   policyName,
+	}, func() error {
+		_, err := m.client.DeleteRolePolicy(ctx, &iam.DeleteRolePolicyInput{
+			PolicyName: aws.String(policyName),
+			RoleName:   aws.String(roleName),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete inline policy %s of role %s: %w", policyName, roleName, err)
+	}
+	return nil
+}
+
+func (m *Manager) listInstanceProfiles(ctx context.Context, roleName string) ([]string, error) {
+	var names []string
+	paginator := iam.NewListInstanceProfilesForRolePaginator(m.client, &iam.ListInstanceProfilesForRoleInput{
+		RoleName: aws.String(roleName),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list instance profiles of role %s: %w", roleName, err)
+		}
+		for _, profile := range out.InstanceProfiles {
+			names = append(names, aws.ToString(profile.InstanceProfileName))
+		}
+	}
+	return names, nil
+}
+
+func (m *Manager) listInlinePolicies(ctx context.Context, roleName string) ([]string, error) {
+	var names []string
+	paginator := iam.NewListRolePoliciesPaginator(m.client, &iam.ListRolePoliciesInput{
+		RoleName: aws.String(roleName),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list inline policies of role %s: %w", roleName, err)
+		}
+		names = append(names, out.PolicyNames...)
+	}
+	return names, nil
+}
+
+// listOwnedRoles lists the roles under the path. The ownership tags of each role
+// are verified as well, so that roles created in the path by hand are never deleted.
+func (m *Manager) listOwnedRoles(ctx context.Context, path string) ([]types.Role, error) {
+	var roles []types.Role
+	paginator := iam.NewListRolesPaginator(m.client, &iam.ListRolesInput{
+		PathPrefix: aws.String(path),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list roles under %s: %w", path, err)
+		}
+		for _, role := range out.Roles {
+			tagsOut, err := m.client.ListRoleTags(ctx, &iam.ListRoleTagsInput{
 				RoleName: role.RoleName,
 			})
 			if err != nil {
-				return fmt.Errorf("failed to delete role %s: %w", *role.RoleName, err)
+				return nil, fmt.Errorf("failed to list tags for role %s: %w", *role.RoleName, err)
 			}
+			if m.owner.ownership(tagsOut.Tags) != ownedBySelf {
+				logrus.Warnf("Role %s is not tagged as owned by %s, ignoring it", *role.RoleName, m.owner)
+				continue
+			}
+			roles = append(roles, role)
 		}
 	}
-
-	return nil
+	return roles, nil
 }
 
-func (m *Manager) listTaggedRoles(ctx context.Context) ([]types.Role, error) {
+// getRootRoles looks up the roles of the given names that older versions created directly
+// under "/", before roles were placed under the owner path. See rootRoleOwned for ownership.
+func (m *Manager) getRootRoles(ctx context.Context, names []string, providers map[string]struct{}) ([]types.Role, error) {
 	var roles []types.Role
-	var marker *string
-	for {
-		out, err := m.client.ListRoles(ctx, &iam.ListRolesInput{
-			Marker: marker,
+	for _, name := range names {
+		out, err := m.client.GetRole(ctx, &iam.GetRoleInput{
+			RoleName: aws.String(name),
 		})
+		var notFoundErr *types.NoSuchEntityException
+		if errors.As(err, &notFoundErr) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role %s: %w", name, err)
+		}
+		// roles under the owner path are listed by listOwnedRoles
+		if aws.ToString(out.Role.Path) != "/" {
+			continue
+		}
+		if m.rootRoleOwned(*out.Role, out.Role.Tags, providers) {
+			roles = append(roles, *out.Role)
+		}
+	}
+	return roles, nil
+}
+
+// listRootRoles lists all roles older versions created directly under "/" that are named
+// after the cluster. It lists every role of the account and is only used to migrate roles
+// that were removed from the config, see WithLegacyRoleScan.
+func (m *Manager) listRootRoles(ctx context.Context, providers map[string]struct{}) ([]types.Role, error) {
+	var roles []types.Role
+	paginator := iam.NewListRolesPaginator(m.client, &iam.ListRolesInput{
+		PathPrefix: aws.String("/"),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to list roles: %w", err)
 		}
 		for _, role := range out.Roles {
+			if aws.ToString(role.Path) != "/" || !strings.HasPrefix(aws.ToString(role.RoleName), m.owner.ClusterName+"-") {
+				continue
+			}
 			tagsOut, err := m.client.ListRoleTags(ctx, &iam.ListRoleTagsInput{
 				RoleName: role.RoleName,
 			})
 			if err != nil {
 				return nil, fmt.Errorf("failed to list tags for role %s: %w", *role.RoleName, err)
 			}
-			for _, tag := range tagsOut.Tags {
-				if *tag.Key == ClusterTagKey && *tag.Value == ClusterTagValue {
-					roles = append(roles, role)
-					break
-				}
+			if m.rootRoleOwned(role, tagsOut.Tags, providers) {
+				roles = append(roles, role)
 			}
 		}
-		if out.IsTruncated {
-			marker = out.Marker
-		} else {
-			break
-		}
 	}
 	return roles, nil
 }
+
+// rootRoleOwned reports whether a role directly under "/" is owned. Roles carrying the owner
+// tags are owned, as the legacy tag is shared by all clusters roles carrying it are only
+// owned if they trust one of the OIDC providers.
+func (m *Manager) rootRoleOwned(role types.Role, tags []types.Tag, providers map[string]struct{}) bool {
+	switch m.owner.ownership(tags) {
+	case ownedBySelf:
+		return true
+	case legacyOwned:
+		return trustsProvider(role, providers)
+	}
+	return false
+}
+
+// trustsProvider reports whether the trust policy of the role references one of the OIDC providers.
+func trustsProvider(role types.Role, providers map[string]struct{}) bool {
+	doc, err := url.PathUnescape(aws.ToString(role.AssumeRolePolicyDocument))
+	if err != nil {
+		return false
+	}
+	for providerArn := range providers {
+		if strings.Contains(doc, providerArn) {
+			return true
+		}
+	}
+	return false
+}
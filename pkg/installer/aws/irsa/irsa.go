@@ -5,47 +5,96 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/moolen/flux-poc/pkg/installer/aws/partition"
+	"github.com/moolen/flux-poc/pkg/installer/plan"
 	"github.com/sirupsen/logrus"
 )
 
-const (
-	ClusterTagKey   = "kubernetes.io/cluster/flux-poc"
-	ClusterTagValue = "owned"
-)
+// defaultMaxSessionDuration is the IAM default of one hour, in seconds.
+const defaultMaxSessionDuration = 3600
 
 type IRSAConfig struct {
-	RoleName         string
-	PolicyArns       []string
-	InlinePolicyName string
-	InlinePolicyDoc  string
-	OIDCProviderArn  string
-	ServiceAccount   string // format: namespace:serviceaccount
-	Audience         string
+	RoleName   string
+	PolicyArns []string
+	// InlinePolicies maps the name of an inline policy to its document.
+	InlinePolicies map[string]string
+	// Policies are customer-managed policies created and attached by the manager.
+	Policies []Policy
+	// OIDCProviderArns are trusted to issue tokens for the role, multiple
+	// providers allow sharing a role between clusters during a migration.
+	OIDCProviderArns []string
+	// ServiceAccounts in the format namespace:serviceaccount. Entries containing
+	// * or ? are matched as patterns, e.g. tenant-*:app.
+	ServiceAccounts []string
+	Audiences       []string
+	// PodIdentity trusts the EKS Pod Identity agent instead of the OIDC providers.
+	// The associations are managed by the podidentity package.
+	PodIdentity bool
+	// Partition is the ID of the partition of the role, e.g. aws-cn. Defaults to aws.
+	Partition string
+	// AccountID of the role. Taken from the first OIDC provider if empty.
+	AccountID string
+
+	// Path is the base path of the role, the owner path is appended to it. Defaults to "/".
+	Path string
+	// PermissionsBoundary is the ARN of the policy used as permissions boundary.
+	PermissionsBoundary string
+	// MaxSessionDuration in seconds, defaults to one hour.
+	MaxSessionDuration int32
+	Description        string
+	// Tags are added to the owner tags of the role.
+	// Tags removed from the config are not removed from the role.
+	Tags map[string]string
 }
 
 type Manager struct {
 	client *iam.Client
+	owner  Owner
+	plan   *plan.Plan
+	// arns of the existing roles by role name, see RoleARNs.
+	arns map[string]string
+	// scanLegacyRoles lists all roles under "/" during garbage collection.
+	scanLegacyRoles bool
 }
 
-var tags = []types.Tag{
-	{
-		Key:   aws.String(ClusterTagKey),
-		Value: aws.String(ClusterTagValue),
-	},
+// New creates a manager for the roles of the given owner.
+func New(cfg aws.Config, owner Owner) *Manager {
+	client := iam.NewFromConfig(cfg, func(o *iam.Options) {
+		// back off when IAM throttles, which is common in shared accounts
+		o.Retryer = retry.NewAdaptiveMode()
+	})
+	return &Manager{client: client, owner: owner, arns: map[string]string{}}
 }
 
-func New(ctx context.Context) (*Manager, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return &Manager{client: iam.NewFromConfig(cfg)}, nil
+// WithPlan puts the manager into plan mode: all changes are recorded
+// in the plan instead of being executed.
+func (m *Manager) WithPlan(p *plan.Plan) *Manager {
+	m.plan = p
+	return m
+}
+
+// WithLegacyRoleScan makes garbage collection list all roles directly under "/" named
+// after the cluster, to find roles created by older versions that were removed from the
+// config. This lists every role of the account and is meant to be run once when migrating,
+// otherwise only the roles of configured names are looked up under "/".
+func (m *Manager) WithLegacyRoleScan(enabled bool) *Manager {
+	m.scanLegacyRoles = enabled
+	return m
+}
+
+// RoleARNs returns the ARNs of the reconciled roles that already existed by role name.
+// Roles created before the owner path keep their path and therefore their ARN, new
+// roles get the ARN returned by Owner.RoleARN.
+func (m *Manager) RoleARNs() map[string]string {
+	return m.arns
 }
 
 func (m *Manager) Reconcile(ctx context.Context, roles []IRSAConfig) error {
@@ -68,99 +117,542 @@ func (m *Manager) ensureRole(ctx context.Context, cfg IRSAConfig) error {
 		RoleName: aws.String(cfg.RoleName),
 	})
 
-	if err != nil {
-		var notFoundErr *types.NoSuchEntityException
-		if errors.As(err, &notFoundErr) {
-			logrus.Debugf("Role %s not found, creating it", cfg.RoleName)
-			_, err := m.client.CreateRole(ctx, &iam.CreateRoleInput{
+	var notFoundErr *types.NoSuchEntityException
+	if err != nil && !errors.As(err, &notFoundErr) {
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+
+	path := m.rolePath(cfg)
+	exists := err == nil
+	if exists {
+		if _, err := m.checkOwnership(getOut.Role); err != nil {
+			return err
+		}
+	}
+	if exists && aws.ToString(getOut.Role.Path) != path {
+		current := aws.ToString(getOut.Role.Path)
+		if strings.HasSuffix(current, m.owner.Path()) {
+			// IAM paths are immutable, a role whose base path changed is replaced
+			logrus.Infof("Role %s has path %s instead of %s, replacing it", cfg.RoleName, current, path)
+			if err := m.deleteRole(ctx, cfg.RoleName); err != nil {
+				return err
+			}
+			// the policies of the role are created at its path and would block the new ones
+			if err := m.deletePoliciesAt(ctx, cfg, current); err != nil {
+				return err
+			}
+			exists = false
+		} else {
+			// roles created before the owner path keep their path, replacing them
+			// would change their ARN and interrupt the pods assuming them
+			logrus.Infof("Role %s was created at path %s before the owner path was introduced, keeping it", cfg.RoleName, current)
+		}
+	}
+	delete(m.arns, cfg.RoleName)
+	if exists {
+		m.arns[cfg.RoleName] = aws.ToString(getOut.Role.Arn)
+	}
+
+	if !exists {
+		logrus.Debugf("Role %s not found, creating it", cfg.RoleName)
+		err := m.plan.Do(plan.Action{
+			Type:     plan.CreateRole,
+			Resource: plan.ResourceIAMRole,
+			Name:     cfg.RoleName,
+			Detail:   fmt.Sprintf("path %s, trust policy for %s", path, strings.Join(cfg.ServiceAccounts, ",")),
+		}, func() error {
+			input := &iam.CreateRoleInput{
 				RoleName:                 aws.String(cfg.RoleName),
+				Path:                     aws.String(path),
 				AssumeRolePolicyDocument: aws.String(assumeRoleDoc),
-				Tags:                     tags,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to create role: %w", err)
+				MaxSessionDuration:       aws.Int32(maxSessionDuration(cfg)),
+				Tags:                     m.roleTags(cfg),
 			}
-		} else {
-			return fmt.Errorf("failed to get role: %w", err)
+			if cfg.Description != "" {
+				input.Description = aws.String(cfg.Description)
+			}
+			if cfg.PermissionsBoundary != "" {
+				input.PermissionsBoundary = aws.String(cfg.PermissionsBoundary)
+			}
+			_, err := m.client.CreateRole(ctx, input)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create role: %w", err)
 		}
 	} else {
+		if err := m.ensureOwnership(ctx, getOut.Role); err != nil {
+			return err
+		}
 		logrus.Debugf("Role %s already exists, checking trust policy", cfg.RoleName)
-		if getOut.Role.AssumeRolePolicyDocument == nil || *getOut.Role.AssumeRolePolicyDocument != assumeRoleDoc {
-			_, err := m.client.UpdateAssumeRolePolicy(ctx, &iam.UpdateAssumeRolePolicyInput{
-				RoleName:       aws.String(cfg.RoleName),
-				PolicyDocument: aws.String(assumeRoleDoc),
+		equal, err := policyEqual(aws.ToString(getOut.Role.AssumeRolePolicyDocument), assumeRoleDoc)
+		if err != nil {
+			return fmt.Errorf("failed to compare trust policy of role %s: %w", cfg.RoleName, err)
+		}
+		if !equal {
+			err := m.plan.Do(plan.Action{
+				Type:     plan.UpdateTrustPolicy,
+				Resource: plan.ResourceIAMRole,
+				Name:     cfg.RoleName,
+				Detail:   assumeRoleDoc,
+			}, func() error {
+				_, err := m.client.UpdateAssumeRolePolicy(ctx, &iam.UpdateAssumeRolePolicyInput{
+					RoleName:       aws.String(cfg.RoleName),
+					PolicyDocument: aws.String(assumeRoleDoc),
+				})
+				return err
 			})
 			if err != nil {
 				return fmt.Errorf("failed to update trust policy: %w", err)
 			}
-			_, err = m.client.TagRole(ctx, &iam.TagRoleInput{
+		}
+		if err := m.ensureRoleAttributes(ctx, cfg, getOut.Role); err != nil {
+			return err
+		}
+	}
+
+	policyArns, err := m.ensurePolicies(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if err := m.ensureManagedPolicies(ctx, cfg, append(policyArns, cfg.PolicyArns...), !exists); err != nil {
+		return err
+	}
+	return m.ensureInlinePolicies(ctx, cfg, !exists)
+}
+
+// ensureRoleAttributes converges description, max session duration,
+// permissions boundary and tags of an existing role.
+func (m *Manager) ensureRoleAttributes(ctx context.Context, cfg IRSAConfig, role *types.Role) error {
+	// an empty description clears the description of the role
+	descriptionChanged := cfg.Description != aws.ToString(role.Description)
+	if descriptionChanged || aws.ToInt32(role.MaxSessionDuration) != maxSessionDuration(cfg) {
+		err := m.plan.Do(plan.Action{
+			Type:     plan.UpdateRole,
+			Resource: plan.ResourceIAMRole,
+			Name:     cfg.RoleName,
+			Detail:   fmt.Sprintf("maxSessionDuration=%ds description=%q", maxSessionDuration(cfg), cfg.Description),
+		}, func() error {
+			_, err := m.client.UpdateRole(ctx, &iam.UpdateRoleInput{
+				RoleName:           aws.String(cfg.RoleName),
+				MaxSessionDuration: aws.Int32(maxSessionDuration(cfg)),
+				Description:        aws.String(cfg.Description),
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update role %s: %w", cfg.RoleName, err)
+		}
+	}
+
+	var currentBoundary string
+	if role.PermissionsBoundary != nil {
+		currentBoundary = aws.ToString(role.PermissionsBoundary.PermissionsBoundaryArn)
+	}
+	switch {
+	case cfg.PermissionsBoundary == currentBoundary:
+	case cfg.PermissionsBoundary == "":
+		err := m.plan.Do(plan.Action{
+			Type:     plan.DeletePermissionsBoundary,
+			Resource: plan.ResourceIAMRole,
+			Name:     cfg.RoleName,
+			Detail:   currentBoundary,
+		}, func() error {
+			_, err := m.client.DeleteRolePermissionsBoundary(ctx, &iam.DeleteRolePermissionsBoundaryInput{
 				RoleName: aws.String(cfg.RoleName),
-				Tags:     tags,
 			})
-			if err != nil {
-				return fmt.Errorf("failed to tag role: %w", err)
-			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete permissions boundary of role %s: %w", cfg.RoleName, err)
+		}
+	default:
+		err := m.plan.Do(plan.Action{
+			Type:     plan.PutPermissionsBoundary,
+			Resource: plan.ResourceIAMRole,
+			Name:     cfg.RoleName,
+			Detail:   cfg.PermissionsBoundary,
+		}, func() error {
+			_, err := m.client.PutRolePermissionsBoundary(ctx, &iam.PutRolePermissionsBoundaryInput{
+				RoleName:            aws.String(cfg.RoleName),
+				PermissionsBoundary: aws.String(cfg.PermissionsBoundary),
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to put permissions boundary of role %s: %w", cfg.RoleName, err)
+		}
+	}
+
+	current := map[string]string{}
+	for _, tag := range role.Tags {
+		current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	// owner tags are handled by ensureOwnership
+	var missing []types.Tag
+	for _, tag := range userTags(cfg) {
+		if v, ok := current[aws.ToString(tag.Key)]; !ok || v != aws.ToString(tag.Value) {
+			missing = append(missing, tag)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	err := m.plan.Do(plan.Action{
+		Type:     plan.TagRole,
+		Resource: plan.ResourceIAMRole,
+		Name:     cfg.RoleName,
+		Detail:   fmt.Sprintf("%d tags", len(missing)),
+	}, func() error {
+		_, err := m.client.TagRole(ctx, &iam.TagRoleInput{
+			RoleName: aws.String(cfg.RoleName),
+			Tags:     missing,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag role %s: %w", cfg.RoleName, err)
+	}
+	return nil
+}
+
+// rolePath returns the base path of the role with the owner path appended.
+func (m *Manager) rolePath(cfg IRSAConfig) string {
+	return m.owner.rolePath(cfg)
+}
+
+// roleTags returns the user tags of the role together with the owner tags.
+func (m *Manager) roleTags(cfg IRSAConfig) []types.Tag {
+	return append(userTags(cfg), m.owner.Tags()...)
+}
+
+// userTags returns the configured tags of the role sorted by key.
+func userTags(cfg IRSAConfig) []types.Tag {
+	keys := make([]string, 0, len(cfg.Tags))
+	for k := range cfg.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tags := make([]types.Tag, 0, len(keys))
+	for _, k := range keys {
+		tags = append(tags, types.Tag{Key: aws.String(k), Value: aws.String(cfg.Tags[k])})
+	}
+	return tags
+}
+
+func maxSessionDuration(cfg IRSAConfig) int32 {
+	if cfg.MaxSessionDuration == 0 {
+		return defaultMaxSessionDuration
+	}
+	return cfg.MaxSessionDuration
+}
+
+// ensureManagedPolicies attaches the given managed policies and detaches all others.
+func (m *Manager) ensureManagedPolicies(ctx context.Context, cfg IRSAConfig, policyArns []string, created bool) error {
+	attached := map[string]struct{}{}
+	if !created {
+		var err error
+		attached, err = m.listAttachedPolicies(ctx, cfg.RoleName)
+		if err != nil {
+			return err
 		}
 	}
 
-	for _, policyArn := range cfg.PolicyArns {
+	desired := map[string]struct{}{}
+	for _, policyArn := range policyArns {
+		desired[policyArn] = struct{}{}
+		if _, ok := attached[policyArn]; ok {
+			continue
+		}
 		logrus.Debugf("Attaching policy %s to role %s", policyArn, cfg.RoleName)
-		_, err := m.client.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{
-			PolicyArn: aws.String(policyArn),
-			RoleName:  aws.String(cfg.RoleName),
+		err := m.plan.Do(plan.Action{
+			Type:     plan.AttachPolicy,
+			Resource: plan.ResourceIAMRole,
+			Name:     cfg.RoleName,
+			Detail:   policyArn,
+		}, func() error {
+			_, err := m.client.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{
+				PolicyArn: aws.String(policyArn),
+				RoleName:  aws.String(cfg.RoleName),
+			})
+			return err
 		})
 		if err != nil {
 			return fmt.Errorf("failed to attach policy %s: %w", policyArn, err)
 		}
 	}
 
-	if cfg.InlinePolicyName != "" && cfg.InlinePolicyDoc != "" {
-		logrus.Debugf("Putting inline policy %s for role %s", cfg.InlinePolicyName, cfg.RoleName)
-		_, err := m.client.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
-			PolicyName:     aws.String(cfg.InlinePolicyName),
-			PolicyDocument: aws.String(cfg.InlinePolicyDoc),
-			RoleName:       aws.String(cfg.RoleName),
+	for policyArn := range attached {
+		if _, ok := desired[policyArn]; ok {
+			continue
+		}
+		logrus.Debugf("Detaching policy %s from role %s", policyArn, cfg.RoleName)
+		if err := m.detachPolicy(ctx, cfg.RoleName, policyArn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureInlinePolicies puts the configured inline policies that differ from the
+// existing ones and deletes all others.
+func (m *Manager) ensureInlinePolicies(ctx context.Context, cfg IRSAConfig, created bool) error {
+	var existing []string
+	if !created {
+		var err error
+		existing, err = m.listInlinePolicies(ctx, cfg.RoleName)
+		if err != nil {
+			return err
+		}
+	}
+	existingSet := map[string]struct{}{}
+	for _, policyName := range existing {
+		existingSet[policyName] = struct{}{}
+	}
+
+	names := make([]string, 0, len(cfg.InlinePolicies))
+	for name := range cfg.InlinePolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		doc := cfg.InlinePolicies[name]
+		if _, ok := existingSet[name]; ok {
+			out, err := m.client.GetRolePolicy(ctx, &iam.GetRolePolicyInput{
+				PolicyName: aws.String(name),
+				RoleName:   aws.String(cfg.RoleName),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to get inline policy %s of role %s: %w", name, cfg.RoleName, err)
+			}
+			equal, err := policyEqual(aws.ToString(out.PolicyDocument), doc)
+			if err != nil {
+				return fmt.Errorf("failed to compare inline policy %s of role %s: %w", name, cfg.RoleName, err)
+			}
+			if equal {
+				continue
+			}
+		}
+		logrus.Debugf("Putting inline policy %s for role %s", name, cfg.RoleName)
+		err := m.plan.Do(plan.Action{
+			Type:     plan.PutInlinePolicy,
+			Resource: plan.ResourceIAMRole,
+			Name:     cfg.RoleName,
+			Detail:   name,
+		}, func() error {
+			_, err := m.client.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+				PolicyName:     aws.String(name),
+				PolicyDocument: aws.String(doc),
+				RoleName:       aws.String(cfg.RoleName),
+			})
+			return err
 		})
 		if err != nil {
-			return fmt.Errorf("failed to put inline policy: %w", err)
+			return fmt.Errorf("failed to put inline policy %s: %w", name, err)
+		}
+	}
+
+	for _, policyName := range existing {
+		if _, ok := cfg.InlinePolicies[policyName]; ok {
+			continue
+		}
+		logrus.Debugf("Deleting inline policy %s of role %s", policyName, cfg.RoleName)
+		if err := m.deleteInlinePolicy(ctx, cfg.RoleName, policyName); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// checkOwnership returns the ownership of an existing role. Roles owned by another
+// cluster or installer instance and roles without any ownership tags, which the
+// installer did not create, are rejected.
+func (m *Manager) checkOwnership(role *types.Role) (ownership, error) {
+	roleName := aws.ToString(role.RoleName)
+	ownership := m.owner.ownership(role.Tags)
+	switch ownership {
+	case ownedByOther:
+		return ownership, fmt.Errorf("role %s is owned by another cluster or installer instance", roleName)
+	case unowned:
+		return ownership, fmt.Errorf("role %s already exists and was not created by the installer", roleName)
+	}
+	return ownership, nil
+}
+
+// ensureOwnership tags an existing role with the owner tags. Only roles with the
+// legacy cluster tag are adopted, see checkOwnership for the rejected roles.
+func (m *Manager) ensureOwnership(ctx context.Context, role *types.Role) error {
+	roleName := aws.ToString(role.RoleName)
+	ownership, err := m.checkOwnership(role)
+	if err != nil || ownership == ownedBySelf {
+		return err
+	}
+
+	logrus.Debugf("Adopting role %s for %s", roleName, m.owner)
+	err = m.plan.Do(plan.Action{
+		Type:     plan.TagRole,
+		Resource: plan.ResourceIAMRole,
+		Name:     roleName,
+		Detail:   m.owner.String(),
+	}, func() error {
+		_, err := m.client.TagRole(ctx, &iam.TagRoleInput{
+			RoleName: aws.String(roleName),
+			Tags:     m.owner.Tags(),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag role %s: %w", roleName, err)
+	}
 
+	err = m.plan.Do(plan.Action{
+		Type:     plan.UntagRole,
+		Resource: plan.ResourceIAMRole,
+		Name:     roleName,
+		Detail:   LegacyClusterTagKey,
+	}, func() error {
+		_, err := m.client.UntagRole(ctx, &iam.UntagRoleInput{
+			RoleName: aws.String(roleName),
+			TagKeys:  []string{LegacyClusterTagKey},
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove legacy tag from role %s: %w", roleName, err)
+	}
 	return nil
 }
 
+func (m *Manager) listAttachedPolicies(ctx context.Context, roleName string) (map[string]struct{}, error) {
+	attached := map[string]struct{}{}
+	paginator := iam.NewListAttachedRolePoliciesPaginator(m.client, &iam.ListAttachedRolePoliciesInput{
+		RoleName: aws.String(roleName),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list attached policies of role %s: %w", roleName, err)
+		}
+		for _, p := range out.AttachedPolicies {
+			attached[aws.ToString(p.PolicyArn)] = struct{}{}
+		}
+	}
+	return attached, nil
+}
+
+// generateTrustPolicy allows the service accounts of the role to assume it through
+// any of the OIDC providers. Exact service accounts and wildcard patterns are
+// matched in separate statements, as conditions within a statement are ANDed.
 func generateTrustPolicy(cfg IRSAConfig) (string, error) {
-	saParts := strings.Split(cfg.ServiceAccount, ":")
-	if len(saParts) != 2 {
-		return "", fmt.Errorf("invalid service account format, expected namespace:serviceaccount")
+	if cfg.PodIdentity {
+		return podIdentityTrustPolicy(cfg)
+	}
+	if len(cfg.OIDCProviderArns) == 0 {
+		return "", fmt.Errorf("no OIDC provider configured")
+	}
+	if len(cfg.ServiceAccounts) == 0 {
+		return "", fmt.Errorf("no service account configured")
+	}
+	if len(cfg.Audiences) == 0 {
+		return "", fmt.Errorf("no audience configured")
+	}
+
+	var exact, patterns []string
+	for _, sa := range cfg.ServiceAccounts {
+		saParts := strings.Split(sa, ":")
+		if len(saParts) != 2 {
+			return "", fmt.Errorf("invalid service account format %q, expected namespace:serviceaccount", sa)
+		}
+		sub := fmt.Sprintf("system:serviceaccount:%s", sa)
+		if strings.ContainsAny(sa, "*?") {
+			patterns = append(patterns, sub)
+		} else {
+			exact = append(exact, sub)
+		}
+	}
+
+	var statements []map[string]interface{}
+	for _, providerArn := range cfg.OIDCProviderArns {
+		issuer, err := oidcIssuer(providerArn)
+		if err != nil {
+			return "", err
+		}
+		if len(exact) > 0 {
+			statements = append(statements, trustStatement(providerArn, issuer, "StringEquals", exact, cfg.Audiences))
+		}
+		if len(patterns) > 0 {
+			statements = append(statements, trustStatement(providerArn, issuer, "StringLike", patterns, cfg.Audiences))
+		}
+	}
+
+	trust := map[string]interface{}{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	}
+
+	b, err := json.Marshal(trust)
+	if err != nil {
+		return "", err
 	}
 
-	sub := fmt.Sprintf("system:serviceaccount:%s", cfg.ServiceAccount)
-	aud := cfg.Audience
+	return string(b), nil
+}
 
+// podIdentityTrustPolicy allows the EKS Pod Identity agent to assume the role
+// on behalf of the associated service accounts.
+func podIdentityTrustPolicy(cfg IRSAConfig) (string, error) {
 	trust := map[string]interface{}{
 		"Version": "2012-10-17",
 		"Statement": []map[string]interface{}{
 			{
 				"Effect": "Allow",
 				"Principal": map[string]string{
-					"Federated": cfg.OIDCProviderArn,
-				},
-				"Action": "sts:AssumeRoleWithWebIdentity",
-				"Condition": map[string]map[string]string{
-					"StringEquals": {
-						fmt.Sprintf("%s:sub", cfg.OIDCProviderArn): sub,
-						fmt.Sprintf("%s:aud", cfg.OIDCProviderArn): aud,
-					},
+					"Service": partition.ForID(cfg.Partition).ServicePrincipal("pods.eks"),
 				},
+				"Action": []string{"sts:AssumeRole", "sts:TagSession"},
 			},
 		},
 	}
-
 	b, err := json.Marshal(trust)
 	if err != nil {
 		return "", err
 	}
-
 	return string(b), nil
 }
+
+func trustStatement(providerArn, issuer, subOperator string, subs, audiences []string) map[string]interface{} {
+	condition := map[string]map[string][]string{
+		"StringEquals": {
+			issuer + ":aud": audiences,
+		},
+	}
+	if condition[subOperator] == nil {
+		condition[subOperator] = map[string][]string{}
+	}
+	condition[subOperator][issuer+":sub"] = subs
+	return map[string]interface{}{
+		"Effect": "Allow",
+		"Principal": map[string]string{
+			"Federated": providerArn,
+		},
+		"Action":    "sts:AssumeRoleWithWebIdentity",
+		"Condition": condition,
+	}
+}
+
+// oidcIssuer returns the issuer of an OIDC provider ARN without scheme,
+// which prefixes the condition keys of the trust policy,
+// e.g. oidc.eks.us-west-2.amazonaws.com/id/1234567890ABCDEF.
+func oidcIssuer(providerArn string) (string, error) {
+	parsed, err := arn.Parse(providerArn)
+	if err != nil {
+		return "", fmt.Errorf("invalid OIDC provider ARN %q: %w", providerArn, err)
+	}
+	issuer, ok := strings.CutPrefix(parsed.Resource, "oidc-provider/")
+	if !ok {
+		return "", fmt.Errorf("%q is not an OIDC provider ARN", providerArn)
+	}
+	return issuer, nil
+}
@@ -0,0 +1,105 @@
+package irsa
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+const (
+	// ClusterTagKey holds the name of the EKS cluster owning a role.
+	ClusterTagKey = "flux-poc.io/cluster"
+	// InstanceTagKey holds the ID of the installer instance owning a role.
+	InstanceTagKey = "flux-poc.io/instance"
+
+	// LegacyClusterTagKey was set on all roles regardless of the cluster.
+	// Roles carrying it are adopted when they are reconciled and are only
+	// garbage collected if they trust the OIDC provider of the cluster.
+	LegacyClusterTagKey   = "kubernetes.io/cluster/flux-poc"
+	LegacyClusterTagValue = "owned"
+)
+
+// Owner identifies the installation that owns a role. Garbage collection
+// only ever considers roles whose tags match the owner.
+type Owner struct {
+	ClusterName string
+	InstanceID  string
+}
+
+func (o Owner) String() string {
+	return fmt.Sprintf("%s=%s,%s=%s", ClusterTagKey, o.ClusterName, InstanceTagKey, o.InstanceID)
+}
+
+// Path returns the IAM path segment identifying the owner. It is appended to the
+// base path of every role, so that listing roles by path prefix finds the owned
+// roles without scanning the account.
+func (o Owner) Path() string {
+	return fmt.Sprintf("/flux-poc/%s/%s/", o.ClusterName, o.InstanceID)
+}
+
+// rolePath returns the base path of the role with the owner path appended.
+func (o Owner) rolePath(cfg IRSAConfig) string {
+	return strings.TrimSuffix(cfg.Path, "/") + o.Path()
+}
+
+// RoleARN returns the ARN of the role created for the owner.
+func (o Owner) RoleARN(cfg IRSAConfig) (string, error) {
+	return iamARN(cfg, "role"+o.rolePath(cfg)+cfg.RoleName)
+}
+
+// Tags returns the tags that mark a role as owned.
+func (o Owner) Tags() []types.Tag {
+	return []types.Tag{
+		{Key: aws.String(ClusterTagKey), Value: aws.String(o.ClusterName)},
+		{Key: aws.String(InstanceTagKey), Value: aws.String(o.InstanceID)},
+	}
+}
+
+// TagMap returns the owner tags in the map form used by EKS.
+func (o Owner) TagMap() map[string]string {
+	return map[string]string{
+		ClusterTagKey:  o.ClusterName,
+		InstanceTagKey: o.InstanceID,
+	}
+}
+
+// Owns reports whether the tags in the map form used by EKS mark a resource as owned.
+func (o Owner) Owns(tags map[string]string) bool {
+	return tags[ClusterTagKey] == o.ClusterName && tags[InstanceTagKey] == o.InstanceID
+}
+
+// ownership is the result of comparing the tags of a role with the owner.
+type ownership int
+
+const (
+	// unowned roles carry no ownership tags at all.
+	unowned ownership = iota
+	// legacyOwned roles only carry the legacy cluster tag.
+	legacyOwned
+	// ownedBySelf roles carry the tags of this owner.
+	ownedBySelf
+	// ownedByOther roles carry ownership tags of a different cluster or instance.
+	ownedByOther
+)
+
+func (o Owner) ownership(tags []types.Tag) ownership {
+	values := map[string]string{}
+	for _, tag := range tags {
+		values[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	cluster, hasCluster := values[ClusterTagKey]
+	instance, hasInstance := values[InstanceTagKey]
+	switch {
+	case hasCluster || hasInstance:
+		if cluster == o.ClusterName && instance == o.InstanceID {
+			return ownedBySelf
+		}
+		return ownedByOther
+	case values[LegacyClusterTagKey] == LegacyClusterTagValue:
+		return legacyOwned
+	default:
+		return unowned
+	}
+}
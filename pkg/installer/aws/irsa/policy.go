@@ -0,0 +1,326 @@
+package irsa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/moolen/flux-poc/pkg/installer/aws/partition"
+	"github.com/moolen/flux-poc/pkg/installer/config/awsmeta"
+	"github.com/moolen/flux-poc/pkg/installer/plan"
+	"github.com/sirupsen/logrus"
+)
+
+// maxPolicyVersions is the number of versions IAM keeps per managed policy.
+const maxPolicyVersions = 5
+
+// Policy is a customer-managed policy created by the manager and attached to a role.
+type Policy struct {
+	// Name is appended to the role name to form the policy name.
+	Name        string
+	Document    string
+	Description string
+}
+
+// RenderPolicy replaces the ${AccountID}, ${Region}, ${ClusterName} and ${Partition}
+// variables in a policy document or ARN. IAM policy variables like ${aws:username}
+// are kept as they are.
+func RenderPolicy(doc string, meta *awsmeta.Metadata) string {
+	return strings.NewReplacer(
+		"${AccountID}", meta.AccountID,
+		"${Region}", meta.Region,
+		"${ClusterName}", meta.ClusterName,
+		"${Partition}", meta.Partition,
+	).Replace(doc)
+}
+
+// policyName returns the name of a customer-managed policy of the role.
+func policyName(cfg IRSAConfig, policy Policy) string {
+	return fmt.Sprintf("%s-%s", cfg.RoleName, policy.Name)
+}
+
+// policyARN returns the ARN of a customer-managed policy of the role.
+func (m *Manager) policyARN(cfg IRSAConfig, policy Policy) (string, error) {
+	return iamARN(cfg, "policy"+m.rolePath(cfg)+policyName(cfg, policy))
+}
+
+// iamARN returns the ARN of an IAM resource of the role in the partition and account
+// of the role. Without an account the account of the first OIDC provider is used.
+func iamARN(cfg IRSAConfig, resource string) (string, error) {
+	accountID := cfg.AccountID
+	if accountID == "" {
+		if len(cfg.OIDCProviderArns) == 0 {
+			return "", fmt.Errorf("no account or OIDC provider configured for role %s", cfg.RoleName)
+		}
+		provider, err := arn.Parse(cfg.OIDCProviderArns[0])
+		if err != nil {
+			return "", fmt.Errorf("invalid OIDC provider ARN %q: %w", cfg.OIDCProviderArns[0], err)
+		}
+		accountID = provider.AccountID
+	}
+	return partition.ForID(cfg.Partition).ARN("iam", "", accountID, resource), nil
+}
+
+// ensurePolicies creates or updates the customer-managed policies of the role
+// and returns their ARNs.
+func (m *Manager) ensurePolicies(ctx context.Context, cfg IRSAConfig) ([]string, error) {
+	var arns []string
+	for _, policy := range cfg.Policies {
+		policyArn, err := m.policyARN(cfg, policy)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.ensurePolicy(ctx, cfg, policy, policyArn); err != nil {
+			return nil, err
+		}
+		arns = append(arns, policyArn)
+	}
+	return arns, nil
+}
+
+func (m *Manager) ensurePolicy(ctx context.Context, cfg IRSAConfig, policy Policy, policyArn string) error {
+	getOut, err := m.client.GetPolicy(ctx, &iam.GetPolicyInput{
+		PolicyArn: aws.String(policyArn),
+	})
+	var notFoundErr *types.NoSuchEntityException
+	if errors.As(err, &notFoundErr) {
+		logrus.Debugf("Policy %s not found, creating it", policyArn)
+		err := m.plan.Do(plan.Action{
+			Type:     plan.CreatePolicy,
+			Resource: plan.ResourceIAMPolicy,
+			Name:     policyName(cfg, policy),
+			Detail:   fmt.Sprintf("path %s", m.rolePath(cfg)),
+		}, func() error {
+			input := &iam.CreatePolicyInput{
+				PolicyName:     aws.String(policyName(cfg, policy)),
+				Path:           aws.String(m.rolePath(cfg)),
+				PolicyDocument: aws.String(policy.Document),
+				Tags:           m.owner.Tags(),
+			}
+			if policy.Description != "" {
+				input.Description = aws.String(policy.Description)
+			}
+			_, err := m.client.CreatePolicy(ctx, input)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create policy %s: %w", policyArn, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get policy %s: %w", policyArn, err)
+	}
+	if m.owner.ownership(getOut.Policy.Tags) != ownedBySelf {
+		return fmt.Errorf("policy %s exists but is not owned by %s", policyArn, m.owner)
+	}
+
+	versionOut, err := m.client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+		PolicyArn: aws.String(policyArn),
+		VersionId: getOut.Policy.DefaultVersionId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get default version of policy %s: %w", policyArn, err)
+	}
+	equal, err := policyEqual(aws.ToString(versionOut.PolicyVersion.Document), policy.Document)
+	if err != nil {
+		return fmt.Errorf("failed to compare document of policy %s: %w", policyArn, err)
+	}
+	if equal {
+		return nil
+	}
+
+	if err := m.prunePolicyVersions(ctx, policyArn); err != nil {
+		return err
+	}
+	err = m.plan.Do(plan.Action{
+		Type:     plan.CreatePolicyVersion,
+		Resource: plan.ResourceIAMPolicy,
+		Name:     policyName(cfg, policy),
+		Detail:   policy.Document,
+	}, func() error {
+		_, err := m.client.CreatePolicyVersion(ctx, &iam.CreatePolicyVersionInput{
+			PolicyArn:      aws.String(policyArn),
+			PolicyDocument: aws.String(policy.Document),
+			SetAsDefault:   true,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create version of policy %s: %w", policyArn, err)
+	}
+	return nil
+}
+
+// deletePoliciesAt deletes the owned customer-managed policies of the role under the
+// given path, they are left behind when the role is replaced at another path.
+func (m *Manager) deletePoliciesAt(ctx context.Context, cfg IRSAConfig, path string) error {
+	for _, policy := range cfg.Policies {
+		policyArn, err := iamARN(cfg, "policy"+path+policyName(cfg, policy))
+		if err != nil {
+			return err
+		}
+		getOut, err := m.client.GetPolicy(ctx, &iam.GetPolicyInput{
+			PolicyArn: aws.String(policyArn),
+		})
+		var notFoundErr *types.NoSuchEntityException
+		if errors.As(err, &notFoundErr) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get policy %s: %w", policyArn, err)
+		}
+		if m.owner.ownership(getOut.Policy.Tags) != ownedBySelf {
+			logrus.Warnf("Policy %s is not owned by %s, keeping it", policyArn, m.owner)
+			continue
+		}
+		logrus.Debugf("Deleting policy %s of replaced role %s", policyArn, cfg.RoleName)
+		if err := m.deletePolicy(ctx, policyArn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prunePolicyVersions deletes the oldest non-default versions of the policy,
+// so that another version can be created without hitting the IAM limit.
+func (m *Manager) prunePolicyVersions(ctx context.Context, policyArn string) error {
+	versions, err := m.listPolicyVersions(ctx, policyArn)
+	if err != nil {
+		return err
+	}
+	var prunable []types.PolicyVersion
+	for _, version := range versions {
+		if !version.IsDefaultVersion {
+			prunable = append(prunable, version)
+		}
+	}
+	sort.Slice(prunable, func(i, j int) bool {
+		return aws.ToTime(prunable[i].CreateDate).Before(aws.ToTime(prunable[j].CreateDate))
+	})
+	for i := 0; i < len(versions)-maxPolicyVersions+1 && i < len(prunable); i++ {
+		if err := m.deletePolicyVersion(ctx, policyArn, aws.ToString(prunable[i].VersionId)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePolicy detaches the policy from all roles and deletes its non-default
+// versions before deleting it, as IAM refuses to delete policies that are still in use.
+func (m *Manager) deletePolicy(ctx context.Context, policyArn string) error {
+	paginator := iam.NewListEntitiesForPolicyPaginator(m.client, &iam.ListEntitiesForPolicyInput{
+		PolicyArn:    aws.String(policyArn),
+		EntityFilter: types.EntityTypeRole,
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list entities of policy %s: %w", policyArn, err)
+		}
+		for _, role := range out.PolicyRoles {
+			if err := m.detachPolicy(ctx, aws.ToString(role.RoleName), policyArn); err != nil {
+				return err
+			}
+		}
+	}
+
+	versions, err := m.listPolicyVersions(ctx, policyArn)
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		if version.IsDefaultVersion {
+			continue
+		}
+		if err := m.deletePolicyVersion(ctx, policyArn, aws.ToString(version.VersionId)); err != nil {
+			return err
+		}
+	}
+
+	err = m.plan.Do(plan.Action{
+		Type:     plan.DeletePolicy,
+		Resource: plan.ResourceIAMPolicy,
+		Name:     policyArn,
+	}, func() error {
+		_, err := m.client.DeletePolicy(ctx, &iam.DeletePolicyInput{
+			PolicyArn: aws.String(policyArn),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete policy %s: %w", policyArn, err)
+	}
+	return nil
+}
+
+func (m *Manager) deletePolicyVersion(ctx context.Context, policyArn, versionID string) error {
+	err := m.plan.Do(plan.Action{
+		Type:     plan.DeletePolicyVersion,
+		Resource: plan.ResourceIAMPolicy,
+		Name:     policyArn,
+		Detail:   versionID,
+	}, func() error {
+		_, err := m.client.DeletePolicyVersion(ctx, &iam.DeletePolicyVersionInput{
+			PolicyArn: aws.String(policyArn),
+			VersionId: aws.String(versionID),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete version %s of policy %s: %w", versionID, policyArn, err)
+	}
+	return nil
+}
+
+func (m *Manager) listPolicyVersions(ctx context.Context, policyArn string) ([]types.PolicyVersion, error) {
+	var versions []types.PolicyVersion
+	paginator := iam.NewListPolicyVersionsPaginator(m.client, &iam.ListPolicyVersionsInput{
+		PolicyArn: aws.String(policyArn),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions of policy %s: %w", policyArn, err)
+		}
+		versions = append(versions, out.Versions...)
+	}
+	return versions, nil
+}
+
+// listOwnedPolicies lists the customer-managed policies under the path
+// whose ownership tags match the owner.
+func (m *Manager) listOwnedPolicies(ctx context.Context, path string) ([]string, error) {
+	var arns []string
+	paginator := iam.NewListPoliciesPaginator(m.client, &iam.ListPoliciesInput{
+		PathPrefix: aws.String(path),
+		Scope:      types.PolicyScopeTypeLocal,
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list policies under %s: %w", path, err)
+		}
+		for _, policy := range out.Policies {
+			policyArn := aws.ToString(policy.Arn)
+			tags, err := m.client.ListPolicyTags(ctx, &iam.ListPolicyTagsInput{
+				PolicyArn: aws.String(policyArn),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to list tags of policy %s: %w", policyArn, err)
+			}
+			if m.owner.ownership(tags.Tags) != ownedBySelf {
+				logrus.Warnf("Policy %s is under %s but not owned by %s, skipping it", policyArn, path, m.owner)
+				continue
+			}
+			arns = append(arns, policyArn)
+		}
+	}
+	return arns, nil
+}
@@ -0,0 +1,94 @@
+package partition
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// Partition is a group of AWS regions with its own ARN namespace and DNS suffix.
+type Partition struct {
+	// ID is the partition in ARNs, e.g. aws-cn.
+	ID string
+	// DNSSuffix of the service endpoints, e.g. amazonaws.com.cn.
+	DNSSuffix string
+	// servicePrincipalSuffix is appended to the service name in service principals.
+	servicePrincipalSuffix string
+	// regionPrefixes identify the regions of the partition.
+	regionPrefixes []string
+}
+
+var (
+	AWS = Partition{
+		ID:                     "aws",
+		DNSSuffix:              "amazonaws.com",
+		servicePrincipalSuffix: "amazonaws.com",
+	}
+	AWSCN = Partition{
+		ID:        "aws-cn",
+		DNSSuffix: "amazonaws.com.cn",
+		// the China regions accept the global service principals
+		servicePrincipalSuffix: "amazonaws.com",
+		regionPrefixes:         []string{"cn-"},
+	}
+	AWSUSGov = Partition{
+		ID:                     "aws-us-gov",
+		DNSSuffix:              "amazonaws.com",
+		servicePrincipalSuffix: "amazonaws.com",
+		regionPrefixes:         []string{"us-gov-"},
+	}
+	AWSISO = Partition{
+		ID:                     "aws-iso",
+		DNSSuffix:              "c2s.ic.gov",
+		servicePrincipalSuffix: "c2s.ic.gov",
+		regionPrefixes:         []string{"us-iso-"},
+	}
+	AWSISOB = Partition{
+		ID:                     "aws-iso-b",
+		DNSSuffix:              "sc2s.sgov.gov",
+		servicePrincipalSuffix: "sc2s.sgov.gov",
+		regionPrefixes:         []string{"us-isob-"},
+	}
+
+	// partitions are matched in order, the commercial partition is the fallback.
+	partitions = []Partition{AWSCN, AWSUSGov, AWSISOB, AWSISO}
+)
+
+// ForRegion returns the partition of the region. Unknown regions belong to the commercial partition.
+func ForRegion(region string) Partition {
+	for _, p := range partitions {
+		for _, prefix := range p.regionPrefixes {
+			if strings.HasPrefix(region, prefix) {
+				return p
+			}
+		}
+	}
+	return AWS
+}
+
+// ForID returns the partition with the given ID, e.g. taken from an ARN.
+// Unknown IDs belong to the commercial partition.
+func ForID(id string) Partition {
+	for _, p := range partitions {
+		if p.ID == id {
+			return p
+		}
+	}
+	return AWS
+}
+
+// ARN returns the ARN of a resource in the partition.
+func (p Partition) ARN(service, region, accountID, resource string) string {
+	return arn.ARN{
+		Partition: p.ID,
+		Service:   service,
+		Region:    region,
+		AccountID: accountID,
+		Resource:  resource,
+	}.String()
+}
+
+// ServicePrincipal returns the principal of an AWS service for trust policies, e.g. pods.eks.amazonaws.com.
+func (p Partition) ServicePrincipal(service string) string {
+	return service + "." + p.servicePrincipalSuffix
+}
@@ -0,0 +1,192 @@
+package podidentity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/eks/types"
+	"github.com/moolen/flux-poc/pkg/installer/aws/irsa"
+	"github.com/moolen/flux-poc/pkg/installer/plan"
+	"github.com/sirupsen/logrus"
+)
+
+// Association binds a service account of the cluster to an IAM role.
+type Association struct {
+	Namespace      string
+	ServiceAccount string
+	RoleArn        string
+}
+
+func (a Association) key() string {
+	return a.Namespace + ":" + a.ServiceAccount
+}
+
+// Manager reconciles the EKS Pod Identity associations of a cluster. Associations
+// are tagged like IRSA roles and only associations of the owner are ever changed.
+type Manager struct {
+	client *eks.Client
+	owner  irsa.Owner
+	plan   *plan.Plan
+}
+
+// New creates a manager for the associations of the given owner in the owner's cluster.
+func New(cfg aws.Config, owner irsa.Owner) *Manager {
+	client := eks.NewFromConfig(cfg, func(o *eks.Options) {
+		o.Retryer = retry.NewAdaptiveMode()
+	})
+	return &Manager{client: client, owner: owner}
+}
+
+// WithPlan puts the manager into plan mode: all changes are recorded
+// in the plan instead of being executed.
+func (m *Manager) WithPlan(p *plan.Plan) *Manager {
+	m.plan = p
+	return m
+}
+
+// Reconcile creates the missing associations and points existing ones to the desired role.
+func (m *Manager) Reconcile(ctx context.Context, desired []Association) error {
+	existing, err := m.listAssociations(ctx)
+	if err != nil {
+		return err
+	}
+	for _, assoc := range desired {
+		summary, ok := existing[assoc.key()]
+		if !ok {
+			if err := m.createAssociation(ctx, assoc); err != nil {
+				return err
+			}
+			continue
+		}
+		current, err := m.describeAssociation(ctx, summary)
+		if err != nil {
+			return err
+		}
+		if !m.owner.Owns(current.Tags) {
+			return fmt.Errorf("pod identity association for %s is not owned by %s", assoc.key(), m.owner)
+		}
+		if aws.ToString(current.RoleArn) == assoc.RoleArn {
+			continue
+		}
+		err = m.plan.Do(plan.Action{
+			Type:     plan.UpdatePodIdentityAssociation,
+			Resource: plan.ResourcePodIdentity,
+			Name:     assoc.key(),
+			Detail:   assoc.RoleArn,
+		}, func() error {
+			_, err := m.client.UpdatePodIdentityAssociation(ctx, &eks.UpdatePodIdentityAssociationInput{
+				AssociationId: current.AssociationId,
+				ClusterName:   aws.String(m.owner.ClusterName),
+				RoleArn:       aws.String(assoc.RoleArn),
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update pod identity association for %s: %w", assoc.key(), err)
+		}
+	}
+	return nil
+}
+
+// GarbageCollect deletes owned associations that are not in the desired set.
+func (m *Manager) GarbageCollect(ctx context.Context, desired []Association) error {
+	desiredSet := make(map[string]struct{})
+	for _, assoc := range desired {
+		desiredSet[assoc.key()] = struct{}{}
+	}
+
+	existing, err := m.listAssociations(ctx)
+	if err != nil {
+		return err
+	}
+	for key, summary := range existing {
+		if _, ok := desiredSet[key]; ok {
+			continue
+		}
+		current, err := m.describeAssociation(ctx, summary)
+		if err != nil {
+			return err
+		}
+		if !m.owner.Owns(current.Tags) {
+			continue
+		}
+		logrus.Debugf("Deleting pod identity association for %s as it is not in the desired set", key)
+		err = m.plan.Do(plan.Action{
+			Type:     plan.DeletePodIdentityAssociation,
+			Resource: plan.ResourcePodIdentity,
+			Name:     key,
+			Detail:   aws.ToString(current.RoleArn),
+		}, func() error {
+			_, err := m.client.DeletePodIdentityAssociation(ctx, &eks.DeletePodIdentityAssociationInput{
+				AssociationId: current.AssociationId,
+				ClusterName:   aws.String(m.owner.ClusterName),
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete pod identity association for %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// DeleteAll deletes all associations owned by the manager's owner.
+func (m *Manager) DeleteAll(ctx context.Context) error {
+	return m.GarbageCollect(ctx, nil)
+}
+
+func (m *Manager) createAssociation(ctx context.Context, assoc Association) error {
+	logrus.Debugf("Creating pod identity association for %s", assoc.key())
+	err := m.plan.Do(plan.Action{
+		Type:     plan.CreatePodIdentityAssociation,
+		Resource: plan.ResourcePodIdentity,
+		Name:     assoc.key(),
+		Detail:   assoc.RoleArn,
+	}, func() error {
+		_, err := m.client.CreatePodIdentityAssociation(ctx, &eks.CreatePodIdentityAssociationInput{
+			ClusterName:    aws.String(m.owner.ClusterName),
+			Namespace:      aws.String(assoc.Namespace),
+			ServiceAccount: aws.String(assoc.ServiceAccount),
+			RoleArn:        aws.String(assoc.RoleArn),
+			Tags:           m.owner.TagMap(),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create pod identity association for %s: %w", assoc.key(), err)
+	}
+	return nil
+}
+
+func (m *Manager) describeAssociation(ctx context.Context, summary types.PodIdentityAssociationSummary) (*types.PodIdentityAssociation, error) {
+	out, err := m.client.DescribePodIdentityAssociation(ctx, &eks.DescribePodIdentityAssociationInput{
+		AssociationId: summary.AssociationId,
+		ClusterName:   aws.String(m.owner.ClusterName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe pod identity association %s: %w", aws.ToString(summary.AssociationId), err)
+	}
+	return out.Association, nil
+}
+
+// listAssociations returns the associations of the cluster by namespace:serviceaccount.
+func (m *Manager) listAssociations(ctx context.Context) (map[string]types.PodIdentityAssociationSummary, error) {
+	associations := map[string]types.PodIdentityAssociationSummary{}
+	paginator := eks.NewListPodIdentityAssociationsPaginator(m.client, &eks.ListPodIdentityAssociationsInput{
+		ClusterName: aws.String(m.owner.ClusterName),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pod identity associations of cluster %s: %w", m.owner.ClusterName, err)
+		}
+		for _, summary := range out.Associations {
+			key := aws.ToString(summary.Namespace) + ":" + aws.ToString(summary.ServiceAccount)
+			associations[key] = summary
+		}
+	}
+	return associations, nil
+}
@@ -3,21 +3,33 @@ package installer
 import (
 	"context"
 	"fmt"
+	"io"
 
+	"github.com/moolen/flux-poc/pkg/installer/applier"
 	"github.com/moolen/flux-poc/pkg/installer/config"
+	"github.com/moolen/flux-poc/pkg/installer/flux"
 	"github.com/moolen/flux-poc/pkg/installer/manifests"
+	"github.com/sirupsen/logrus"
 )
 
 func (i *Installer) buildManifests() ([]byte, error) {
-	kustomizeManifests, err := i.kustomizeRender.Render(manifests.FS())
+	arns, err := i.serviceAccountRoleARNs()
+	if err != nil {
+		return nil, err
+	}
+	kustomizeManifests, err := i.kustomizeRender.Render(manifests.FS(), serviceAccountPatches(arns)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to render kustomize manifests: %w", err)
 	}
-	configManifests, err := config.Render()
+	configManifests, err := config.Render(i.context.AWSMeta, i.context.KubeMeta)
 	if err != nil {
 		return nil, fmt.Errorf("failed to render config manifests: %w", err)
 	}
-	return mergeManifests(kustomizeManifests, configManifests), nil
+	fluxManifests, err := flux.Render(i.context.Spec.Flux.Source, config.ClusterConfigName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render flux source manifests: %w", err)
+	}
+	return mergeManifests(kustomizeManifests, configManifests, fluxManifests), nil
 }
 
 func (i *Installer) ApplyBootstrapManifests() error {
@@ -26,7 +38,73 @@ func (i *Installer) ApplyBootstrapManifests() error {
 		return fmt.Errorf("failed to build manifests: %w", err)
 	}
 	fmt.Printf("%s", string(manifests))
-	return applyYAMLManifests(context.TODO(), manifests)
+
+	a, err := newApplier()
+	if err != nil {
+		return err
+	}
+	arns, err := i.serviceAccountRoleARNs()
+	if err != nil {
+		return err
+	}
+	previous, err := i.currentRoleARNs(context.TODO(), arns)
+	if err != nil {
+		return err
+	}
+	refs, err := a.Apply(context.TODO(), manifests)
+	if err != nil {
+		return err
+	}
+	if err := a.Prune(context.TODO(), refs); err != nil {
+		return fmt.Errorf("failed to prune bootstrap objects: %w", err)
+	}
+	if err := i.annotateServiceAccounts(context.TODO(), arns, previous, refs); err != nil {
+		return err
+	}
+	if err := i.restartWorkloads(context.TODO(), arns, previous); err != nil {
+		return err
+	}
+	return a.WaitForHealthy(context.TODO(), refs, i.context.Spec.Bootstrap.WaitTimeout.Duration)
+}
+
+// RenderBootstrapManifests writes the bootstrap manifests without accessing the cluster.
+func (i *Installer) RenderBootstrapManifests(w io.Writer) error {
+	manifests, err := i.buildManifests()
+	if err != nil {
+		return fmt.Errorf("failed to build manifests: %w", err)
+	}
+	_, err = w.Write(manifests)
+	return err
+}
+
+// DiffBootstrapManifests writes the changes ApplyBootstrapManifests would make to the cluster.
+func (i *Installer) DiffBootstrapManifests(w io.Writer) error {
+	manifests, err := i.buildManifests()
+	if err != nil {
+		return fmt.Errorf("failed to build manifests: %w", err)
+	}
+	a, err := newApplier()
+	if err != nil {
+		return err
+	}
+	changed, err := a.Diff(context.TODO(), manifests, w)
+	if err != nil {
+		return fmt.Errorf("failed to diff manifests: %w", err)
+	}
+	logrus.Infof("%d objects would change", changed)
+	return nil
+}
+
+func newApplier() (*applier.Applier, error) {
+	restConfig, err := getKubeConfig()
+	if err != nil {
+		return nil, err
+	}
+	a, err := applier.New(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create applier: %w", err)
+	}
+	return a, nil
 }
 
 func mergeManifests(manifests ...[]byte) []byte {
@@ -6,102 +6,192 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/moolen/flux-poc/pkg/installer/aws/awsconfig"
+	"github.com/moolen/flux-poc/pkg/installer/aws/partition"
 )
 
 // MetadataKeys for returned map
 const (
 	KeyAccountID       = "aws_account_id"
+	KeyIAMAccountID    = "iam_account_id"
 	KeyRegion          = "aws_region"
 	KeyClusterName     = "cluster_name"
 	KeyOIDCProviderARN = "oidc_provider_arn"
+	KeyPartition       = "aws_partition"
+	KeyDNSSuffix       = "aws_dns_suffix"
+
+	KeyVPCID                  = "vpc_id"
+	KeySubnetIDs              = "subnet_ids"
+	KeyPublicSubnetIDs        = "public_subnet_ids"
+	KeyPrivateSubnetIDs       = "private_subnet_ids"
+	KeyAvailabilityZones      = "availability_zones"
+	KeyClusterSecurityGroupID = "cluster_security_group_id"
+	KeyKubernetesVersion      = "kubernetes_version"
+	KeyPlatformVersion        = "platform_version"
+	KeyEndpointAccess         = "endpoint_access"
+	KeyAddons                 = "addons"
+	KeyNodeGroups             = "node_groups"
+	KeySecretsKMSKeyARN       = "secrets_kms_key_arn"
 
 	kubeHostEnv = "KUBERNETES_SERVICE_HOST"
 )
 
 type Metadata struct {
-	AccountID       string `json:"aws_account_id"`
+	AccountID string `json:"aws_account_id"`
+	// IAMAccountID is the account of the IAM roles and the OIDC provider.
+	IAMAccountID    string `json:"iam_account_id"`
 	Region          string `json:"aws_region"`
 	ClusterName     string `json:"cluster_name"`
 	OIDCProviderARN string `json:"oidc_provider_arn"`
+	Partition       string `json:"aws_partition"`
+	DNSSuffix       string `json:"aws_dns_suffix"`
+
+	VPCID                  string      `json:"vpc_id"`
+	Subnets                []Subnet    `json:"subnets"`
+	ClusterSecurityGroupID string      `json:"cluster_security_group_id"`
+	KubernetesVersion      string      `json:"kubernetes_version"`
+	PlatformVersion        string      `json:"platform_version"`
+	EndpointAccess         string      `json:"endpoint_access"`
+	Addons                 []Addon     `json:"addons"`
+	NodeGroups             []NodeGroup `json:"node_groups"`
+	SecretsKMSKeyARN       string      `json:"secrets_kms_key_arn"`
 }
 
+// ToMap flattens the metadata into substitution variables. Lists are joined with commas,
+// add-ons and node groups get a variable per attribute, e.g. addon_vpc_cni_version.
 func (m *Metadata) ToMap() map[string]string {
-	return map[string]string{
+	vars := map[string]string{
 		KeyAccountID:       aws.ToString(&m.AccountID),
+		KeyIAMAccountID:    m.IAMAccountID,
 		KeyRegion:          aws.ToString(&m.Region),
 		KeyClusterName:     aws.ToString(&m.ClusterName),
 		KeyOIDCProviderARN: aws.ToString(&m.OIDCProviderARN),
+		KeyPartition:       m.Partition,
+		KeyDNSSuffix:       m.DNSSuffix,
+
+		KeyVPCID:                  m.VPCID,
+		KeyClusterSecurityGroupID: m.ClusterSecurityGroupID,
+		KeyKubernetesVersion:      m.KubernetesVersion,
+		KeyPlatformVersion:        m.PlatformVersion,
+		KeyEndpointAccess:         m.EndpointAccess,
+		KeySecretsKMSKeyARN:       m.SecretsKMSKeyARN,
 	}
+
+	var subnets, public, private, zones []string
+	seenZones := map[string]struct{}{}
+	for _, s := range m.Subnets {
+		subnets = append(subnets, s.ID)
+		if s.Public {
+			public = append(public, s.ID)
+		} else {
+			private = append(private, s.ID)
+		}
+		if _, ok := seenZones[s.AvailabilityZone]; !ok {
+			seenZones[s.AvailabilityZone] = struct{}{}
+			zones = append(zones, s.AvailabilityZone)
+		}
+		vars[varName(s.ID)+"_availability_zone"] = s.AvailabilityZone
+	}
+	sort.Strings(zones)
+	vars[KeySubnetIDs] = strings.Join(subnets, ",")
+	vars[KeyPublicSubnetIDs] = strings.Join(public, ",")
+	vars[KeyPrivateSubnetIDs] = strings.Join(private, ",")
+	vars[KeyAvailabilityZones] = strings.Join(zones, ",")
+
+	var addons []string
+	for _, a := range m.Addons {
+		addons = append(addons, a.Name)
+		vars["addon_"+varName(a.Name)+"_version"] = a.Version
+	}
+	vars[KeyAddons] = strings.Join(addons, ",")
+
+	var nodeGroups []string
+	for _, ng := range m.NodeGroups {
+		nodeGroups = append(nodeGroups, ng.Name)
+		vars["node_group_"+varName(ng.Name)+"_instance_types"] = strings.Join(ng.InstanceTypes, ",")
+		vars["node_group_"+varName(ng.Name)+"_ami_type"] = ng.AMIType
+	}
+	vars[KeyNodeGroups] = strings.Join(nodeGroups, ",")
+	return vars
 }
 
 // Load returns AWS account ID, region, and EKS cluster name inferred from environment and STS.
-func Load() (*Metadata, error) {
-	// Load AWS config with default credential chain and region resolution
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+// The cluster is described with the EKS config, the OIDC provider is expected in the account of the IAM config.
+func Load(ctx context.Context, cfg *awsconfig.Config, opts Options) (*Metadata, error) {
+	// matching the API server against all clusters of the account takes a request per cluster
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
 	defer cancel()
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
-	}
 
 	// Get AWS Account ID via STS
-	stsClient := sts.NewFromConfig(cfg)
+	stsClient := sts.NewFromConfig(cfg.EKS)
 	identity, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get caller identity: %w", err)
 	}
 
 	// Get region from loaded config
-	region := cfg.Region
+	region := cfg.EKS.Region
 	if region == "" {
 		return nil, fmt.Errorf("AWS region not found in config")
 	}
 
-	clusterName, err := inferClusterNameFromKubeHost()
+	p := partition.ForRegion(region)
+	eksClient := eks.NewFromConfig(cfg.EKS)
+	clusterName, err := resolveClusterName(ctx, eksClient, p, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to infer EKS cluster name: %w", err)
 	}
 
-	oidcProviderArn, err := getOIDCProviderARN(ctx, clusterName)
+	cluster, err := describeCluster(ctx, eksClient, clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The IAM roles and the OIDC provider live in the account of the IAM config
+	iamIdentity, err := sts.NewFromConfig(cfg.IAM).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity of the IAM account: %w", err)
+	}
+	iamAccountID := aws.ToString(iamIdentity.Account)
+
+	oidcProviderArn, err := getOIDCProviderARN(p, iamAccountID, cluster)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get OIDC provider ARN: %w", err)
 	}
 
-	return &Metadata{
+	meta := &Metadata{
 		AccountID:       aws.ToString(identity.Account),
+		IAMAccountID:    iamAccountID,
 		Region:          region,
 		ClusterName:     clusterName,
 		OIDCProviderARN: oidcProviderArn,
-	}, nil
-}
-
-func GetRegion() (string, error) {
-	// Load AWS config with default credential chain and region resolution
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-	defer cancel()
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return "", fmt.Errorf("failed to load AWS config: %w", err)
+		Partition:       p.ID,
+		DNSSuffix:       p.DNSSuffix,
 	}
-	return cfg.Region, nil
+	if err := meta.discoverCluster(ctx, eksClient, ec2.NewFromConfig(cfg.EKS), cluster); err != nil {
+		return nil, fmt.Errorf("failed to discover EKS cluster %s: %w", clusterName, err)
+	}
+	return meta, nil
 }
 
 // inferClusterNameFromKubeHost tries to parse the EKS cluster name from the in-cluster DNS hostname.
-func inferClusterNameFromKubeHost() (string, error) {
+func inferClusterNameFromKubeHost(p partition.Partition) (string, error) {
 	kubeHost := os.Getenv(kubeHostEnv)
 	if kubeHost == "" {
 		return "", fmt.Errorf("not running inside a Kubernetes cluster (missing %s)", kubeHostEnv)
 	}
 
 	// Attempt to match EKS cluster endpoint style
-	// e.g. "<cluster-name>.yl4.us-west-2.eks.amazonaws.com"
+	// e.g. "<cluster-name>.yl4.us-west-2.eks.amazonaws.com" or "<cluster-name>.yl4.cn-north-1.eks.amazonaws.com.cn"
 	hostname := kubeHost
 	if !strings.Contains(hostname, ".") {
 		hostname += ".default.svc" // fallback DNS suffix
@@ -113,7 +203,7 @@ func inferClusterNameFromKubeHost() (string, error) {
 		return "", fmt.Errorf("unable to parse Kubernetes host: %w", err)
 	}
 
-	re := regexp.MustCompile(`^([a-zA-Z0-9-]+)\..*\.eks\.amazonaws\.com$`)
+	re := regexp.MustCompile(`^([a-zA-Z0-9-]+)\..*\.eks\.` + regexp.QuoteMeta(p.DNSSuffix) + `$`)
 	matches := re.FindStringSubmatch(u.Host)
 	if len(matches) != 2 {
 		return "", fmt.Errorf("hostname %s doesn't look like an EKS endpoint", u.Host)
@@ -122,36 +212,18 @@ func inferClusterNameFromKubeHost() (string, error) {
 	return matches[1], nil
 }
 
-func getOIDCProviderARN(ctx context.Context, clusterName string) (string, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return "", err
-	}
-
-	eksClient := eks.NewFromConfig(cfg)
-
-	out, err := eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{
-		Name: aws.String(clusterName),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to describe EKS cluster: %w", err)
+func getOIDCProviderARN(p partition.Partition, iamAccountID string, cluster *ekstypes.Cluster) (string, error) {
+	var issuer string
+	if cluster.Identity != nil && cluster.Identity.Oidc != nil {
+		issuer = aws.ToString(cluster.Identity.Oidc.Issuer)
 	}
-
-	issuer := aws.ToString(out.Cluster.Identity.Oidc.Issuer)
 	if issuer == "" {
 		return "", fmt.Errorf("OIDC issuer not found in cluster identity")
 	}
 
 	// Example: issuer = "https://oidc.eks.us-west-2.amazonaws.com/id/1234567890ABCDEF"
-	// ARN format: arn:aws:iam::<account_id>:oidc-provider/oidc.eks.us-west-2.amazonaws.com/id/1234567890ABCDEF
+	// ARN format: arn:<partition>:iam::<account_id>:oidc-provider/oidc.eks.us-west-2.amazonaws.com/id/1234567890ABCDEF
 	issuer = strings.TrimPrefix(issuer, "https://")
-
-	// Get AWS Account ID via STS
-	stsClient := sts.NewFromConfig(cfg)
-	identity, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
-	if err != nil {
-		return "", fmt.Errorf("failed to get caller identity: %w", err)
-	}
-	oidcARN := fmt.Sprintf("arn:aws:iam::%s:oidc-provider/%s", aws.ToString(identity.Account), issuer)
+	oidcARN := p.ARN("iam", "", iamAccountID, "oidc-provider/"+issuer)
 	return oidcARN, nil
 }
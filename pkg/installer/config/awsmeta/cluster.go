@@ -0,0 +1,217 @@
+package awsmeta
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
+)
+
+const (
+	// subnets tagged for load balancers, see
+	// https://docs.aws.amazon.com/eks/latest/userguide/network-load-balancing.html
+	publicELBTag   = "kubernetes.io/role/elb"
+	internalELBTag = "kubernetes.io/role/internal-elb"
+
+	EndpointAccessPublic           = "public"
+	EndpointAccessPrivate          = "private"
+	EndpointAccessPublicAndPrivate = "public-and-private"
+)
+
+// Subnet is a subnet of the cluster VPC configuration.
+type Subnet struct {
+	ID               string `json:"id"`
+	AvailabilityZone string `json:"availability_zone"`
+	// Public subnets are tagged for internet-facing load balancers. Untagged subnets
+	// are public if they assign public IPs on launch.
+	Public bool `json:"public"`
+}
+
+// Addon is an EKS add-on installed in the cluster.
+type Addon struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// NodeGroup is a managed node group of the cluster.
+type NodeGroup struct {
+	Name          string   `json:"name"`
+	InstanceTypes []string `json:"instance_types"`
+	AMIType       string   `json:"ami_type"`
+}
+
+// describeCluster returns the EKS cluster.
+func describeCluster(ctx context.Context, client *eks.Client, clusterName string) (*ekstypes.Cluster, error) {
+	out, err := client.DescribeCluster(ctx, &eks.DescribeClusterInput{
+		Name: aws.String(clusterName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe EKS cluster: %w", err)
+	}
+	return out.Cluster, nil
+}
+
+// discoverCluster fills the network, version, add-on and node group details of the cluster.
+func (m *Metadata) discoverCluster(ctx context.Context, eksClient *eks.Client, ec2Client *ec2.Client, cluster *ekstypes.Cluster) error {
+	m.KubernetesVersion = aws.ToString(cluster.Version)
+	m.PlatformVersion = aws.ToString(cluster.PlatformVersion)
+	for _, enc := range cluster.EncryptionConfig {
+		if enc.Provider != nil && enc.Provider.KeyArn != nil {
+			m.SecretsKMSKeyARN = aws.ToString(enc.Provider.KeyArn)
+		}
+	}
+
+	if vpc := cluster.ResourcesVpcConfig; vpc != nil {
+		m.VPCID = aws.ToString(vpc.VpcId)
+		m.ClusterSecurityGroupID = aws.ToString(vpc.ClusterSecurityGroupId)
+		m.EndpointAccess = endpointAccess(vpc.EndpointPublicAccess, vpc.EndpointPrivateAccess)
+		subnets, err := describeSubnets(ctx, ec2Client, vpc.SubnetIds)
+		if err != nil {
+			return err
+		}
+		m.Subnets = subnets
+	}
+
+	addons, err := listAddons(ctx, eksClient, m.ClusterName)
+	if err != nil {
+		return err
+	}
+	m.Addons = addons
+
+	nodeGroups, err := listNodeGroups(ctx, eksClient, m.ClusterName)
+	if err != nil {
+		return err
+	}
+	m.NodeGroups = nodeGroups
+	return nil
+}
+
+func endpointAccess(public, private bool) string {
+	switch {
+	case public && private:
+		return EndpointAccessPublicAndPrivate
+	case private:
+		return EndpointAccessPrivate
+	default:
+		return EndpointAccessPublic
+	}
+}
+
+// describeSubnets returns the subnets in the order of the cluster VPC configuration.
+func describeSubnets(ctx context.Context, client *ec2.Client, ids []string) ([]Subnet, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	found := map[string]Subnet{}
+	paginator := ec2.NewDescribeSubnetsPaginator(client, &ec2.DescribeSubnetsInput{
+		SubnetIds: ids,
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe subnets of the cluster: %w", err)
+		}
+		for _, s := range out.Subnets {
+			public := aws.ToBool(s.MapPublicIpOnLaunch)
+			for _, tag := range s.Tags {
+				switch aws.ToString(tag.Key) {
+				case publicELBTag:
+					public = true
+				case internalELBTag:
+					public = false
+				}
+			}
+			found[aws.ToString(s.SubnetId)] = Subnet{
+				ID:               aws.ToString(s.SubnetId),
+				AvailabilityZone: aws.ToString(s.AvailabilityZone),
+				Public:           public,
+			}
+		}
+	}
+	subnets := make([]Subnet, 0, len(ids))
+	for _, id := range ids {
+		if s, ok := found[id]; ok {
+			subnets = append(subnets, s)
+		}
+	}
+	return subnets, nil
+}
+
+// listAddons returns the add-ons of the cluster sorted by name.
+func listAddons(ctx context.Context, client *eks.Client, clusterName string) ([]Addon, error) {
+	var addons []Addon
+	paginator := eks.NewListAddonsPaginator(client, &eks.ListAddonsInput{
+		ClusterName: aws.String(clusterName),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list add-ons of cluster %s: %w", clusterName, err)
+		}
+		for _, name := range out.Addons {
+			addon, err := client.DescribeAddon(ctx, &eks.DescribeAddonInput{
+				ClusterName: aws.String(clusterName),
+				AddonName:   aws.String(name),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe add-on %s: %w", name, err)
+			}
+			addons = append(addons, Addon{
+				Name:    name,
+				Version: aws.ToString(addon.Addon.AddonVersion),
+			})
+		}
+	}
+	sort.Slice(addons, func(a, b int) bool { return addons[a].Name < addons[b].Name })
+	return addons, nil
+}
+
+// listNodeGroups returns the managed node groups of the cluster sorted by name.
+func listNodeGroups(ctx context.Context, client *eks.Client, clusterName string) ([]NodeGroup, error) {
+	var nodeGroups []NodeGroup
+	paginator := eks.NewListNodegroupsPaginator(client, &eks.ListNodegroupsInput{
+		ClusterName: aws.String(clusterName),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list node groups of cluster %s: %w", clusterName, err)
+		}
+		for _, name := range out.Nodegroups {
+			ng, err := client.DescribeNodegroup(ctx, &eks.DescribeNodegroupInput{
+				ClusterName:   aws.String(clusterName),
+				NodegroupName: aws.String(name),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe node group %s: %w", name, err)
+			}
+			nodeGroups = append(nodeGroups, NodeGroup{
+				Name:          name,
+				InstanceTypes: ng.Nodegroup.InstanceTypes,
+				AMIType:       string(ng.Nodegroup.AmiType),
+			})
+		}
+	}
+	sort.Slice(nodeGroups, func(a, b int) bool { return nodeGroups[a].Name < nodeGroups[b].Name })
+	return nodeGroups, nil
+}
+
+// varName turns a resource name into a part of a substitution variable name,
+// Flux only allows letters, digits and underscores.
+func varName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,143 @@
+package awsmeta
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/moolen/flux-poc/pkg/installer/aws/partition"
+	"github.com/sirupsen/logrus"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Options configures the discovery of the EKS cluster.
+type Options struct {
+	// ClusterName skips the cluster name discovery.
+	ClusterName string
+	// Kubeconfig is used out of cluster, the cluster name is taken from its current context.
+	Kubeconfig *clientcmdapi.Config
+	// APIServer is the URL of the Kubernetes API server. It is matched against the
+	// endpoints of the EKS clusters in the account as a last resort.
+	APIServer string
+}
+
+// resolveClusterName returns the name of the EKS cluster. It tries, in order, the explicit
+// name, the current context of the kubeconfig, the in-cluster API server hostname and
+// finally the endpoints of the EKS clusters in the account.
+func resolveClusterName(ctx context.Context, client *eks.Client, p partition.Partition, opts Options) (string, error) {
+	if opts.ClusterName != "" {
+		return opts.ClusterName, nil
+	}
+	if name := clusterNameFromKubeconfig(opts.Kubeconfig); name != "" {
+		logrus.Debugf("Using cluster name %s from the current kubeconfig context", name)
+		return name, nil
+	}
+	name, err := inferClusterNameFromKubeHost(p)
+	if err == nil {
+		return name, nil
+	}
+	logrus.Debugf("Cluster name not found in the environment: %v", err)
+	if opts.APIServer == "" {
+		return "", fmt.Errorf("cluster name not found, set it with --cluster-name")
+	}
+	name, err = clusterNameFromEndpoint(ctx, client, opts.APIServer)
+	if err != nil {
+		return "", fmt.Errorf("%w, set it with --cluster-name", err)
+	}
+	logrus.Debugf("Using cluster name %s matching the API server %s", name, opts.APIServer)
+	return name, nil
+}
+
+// clusterNameFromKubeconfig returns the cluster name of the current context. aws eks
+// update-kubeconfig names the context and the cluster after the cluster ARN, other
+// tools pass the name to the exec credential plugin.
+func clusterNameFromKubeconfig(kubeconfig *clientcmdapi.Config) string {
+	if kubeconfig == nil {
+		return ""
+	}
+	kubeContext := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if kubeContext == nil {
+		return ""
+	}
+	for _, name := range []string{kubeconfig.CurrentContext, kubeContext.Cluster} {
+		if clusterName := clusterNameFromARN(name); clusterName != "" {
+			return clusterName
+		}
+	}
+	authInfo := kubeconfig.AuthInfos[kubeContext.AuthInfo]
+	if authInfo == nil || authInfo.Exec == nil {
+		return ""
+	}
+	// aws eks get-token --cluster-name <name>, aws-iam-authenticator token -i <name>
+	return flagValue(authInfo.Exec.Args, "--cluster-name", "--cluster-id", "-i")
+}
+
+// clusterNameFromARN returns the name of an EKS cluster ARN,
+// e.g. arn:aws:eks:eu-west-1:123456789012:cluster/<name>.
+func clusterNameFromARN(s string) string {
+	if !arn.IsARN(s) {
+		return ""
+	}
+	parsed, err := arn.Parse(s)
+	if err != nil || parsed.Service != "eks" {
+		return ""
+	}
+	name, ok := strings.CutPrefix(parsed.Resource, "cluster/")
+	if !ok {
+		return ""
+	}
+	return name
+}
+
+// flagValue returns the value of the first flag found in args,
+// passed either as "--flag value" or "--flag=value".
+func flagValue(args []string, flags ...string) string {
+	for i, arg := range args {
+		for _, flag := range flags {
+			if arg == flag && i+1 < len(args) {
+				return args[i+1]
+			}
+			if value, ok := strings.CutPrefix(arg, flag+"="); ok {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// clusterNameFromEndpoint returns the name of the EKS cluster in the account and region
+// whose endpoint matches the API server URL.
+func clusterNameFromEndpoint(ctx context.Context, client *eks.Client, apiServer string) (string, error) {
+	server, err := url.Parse(apiServer)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse API server URL %s: %w", apiServer, err)
+	}
+
+	paginator := eks.NewListClustersPaginator(client, &eks.ListClustersInput{})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list EKS clusters: %w", err)
+		}
+		for _, name := range out.Clusters {
+			cluster, err := client.DescribeCluster(ctx, &eks.DescribeClusterInput{
+				Name: aws.String(name),
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to describe EKS cluster %s: %w", name, err)
+			}
+			endpoint, err := url.Parse(aws.ToString(cluster.Cluster.Endpoint))
+			if err != nil {
+				continue
+			}
+			if strings.EqualFold(endpoint.Hostname(), server.Hostname()) {
+				return name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no EKS cluster with endpoint %s found", server.Hostname())
+}
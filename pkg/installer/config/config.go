@@ -11,18 +11,24 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 
 	"github.com/moolen/flux-poc/pkg/installer/config/awsmeta"
+	"github.com/moolen/flux-poc/pkg/installer/config/kubemeta"
 )
 
-func Render() ([]byte, error) {
+const (
+	// ClusterConfigName is the name of the ConfigMap holding the discovered cluster metadata.
+	// Flux substitutes its values into the platform workloads.
+	ClusterConfigName = "cluster-config"
+	// ClusterConfigNamespace must match the namespace of the Flux root Kustomization.
+	ClusterConfigNamespace = "flux-system"
+)
+
+// Render returns the cluster-config ConfigMap holding the discovered AWS and Kubernetes metadata.
+func Render(awsMeta *awsmeta.Metadata, kubeMeta *kubemeta.Metadata) ([]byte, error) {
 	config := make(map[string]string)
 	config["hello"] = "world"
-	awsMeta, err := awsmeta.Load()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get AWS metadata: %w", err)
-	}
-	mergedMaps := mergeMaps(config, awsMeta.ToMap())
+	mergedMaps := mergeMaps(config, awsMeta.ToMap(), kubeMeta.ToMap())
 
-	cm, err := mapToConfigMapYAML("cluster-config", "default", mergedMaps)
+	cm, err := mapToConfigMapYAML(ClusterConfigName, ClusterConfigNamespace, mergedMaps)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ConfigMap YAML: %w", err)
 	}
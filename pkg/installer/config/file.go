@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/moolen/flux-poc/pkg/apis/installer/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// LoadFile reads an InstallerConfig from the given path, applies defaults and validates it.
+func LoadFile(path string) (*v1alpha1.InstallationSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg v1alpha1.InstallerConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode config file %s: %w", path, err)
+	}
+	if cfg.APIVersion != v1alpha1.GroupVersion.String() || cfg.Kind != v1alpha1.InstallerConfigKind {
+		return nil, fmt.Errorf("unsupported config %s/%s in %s, expected %s/%s",
+			cfg.APIVersion, cfg.Kind, path, v1alpha1.GroupVersion.String(), v1alpha1.InstallerConfigKind)
+	}
+
+	v1alpha1.SetDefaults(&cfg.InstallationSpec)
+	if errs := v1alpha1.Validate(&cfg.InstallationSpec, nil); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, errs.ToAggregate())
+	}
+	return &cfg.InstallationSpec, nil
+}
@@ -0,0 +1,101 @@
+package kubemeta
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultClusterDNSDomain is used if the domain can neither be read from
+	// the CoreDNS config nor resolved.
+	DefaultClusterDNSDomain = "cluster.local"
+
+	dnsNamespace      = "kube-system"
+	corednsConfigMap  = "coredns"
+	kubernetesSvcName = "kubernetes.default.svc"
+	dnsProbeTimeout   = 5 * time.Second
+)
+
+// dnsServiceNames are the names of the cluster DNS service, EKS keeps the
+// kube-dns name for CoreDNS.
+var dnsServiceNames = []string{"kube-dns", "coredns"}
+
+// discoverClusterDNSDomain reads the domain from the kubernetes plugin of the
+// CoreDNS Corefile. If there is none it resolves kubernetes.default.svc with the
+// search domains of the local resolver, which only works inside the cluster.
+func discoverClusterDNSDomain(ctx context.Context, clientset kubernetes.Interface) (string, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(dnsNamespace).Get(ctx, corednsConfigMap, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("failed to get %s ConfigMap: %w", corednsConfigMap, err)
+	}
+	if err == nil {
+		if domain := corefileDomain(cm.Data["Corefile"]); domain != "" {
+			return domain, nil
+		}
+	}
+	return probeClusterDNSDomain(ctx)
+}
+
+// corefileDomain returns the first forward zone of the kubernetes plugin, e.g.
+// cluster.local for "kubernetes cluster.local in-addr.arpa ip6.arpa {".
+func corefileDomain(corefile string) string {
+	scanner := bufio.NewScanner(strings.NewReader(corefile))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "kubernetes" {
+			continue
+		}
+		for _, zone := range fields[1:] {
+			if zone == "{" {
+				break
+			}
+			zone = strings.TrimSuffix(zone, ".")
+			// reverse zones for PTR records of pods and services
+			if strings.HasSuffix(zone, "in-addr.arpa") || strings.HasSuffix(zone, "ip6.arpa") {
+				continue
+			}
+			return zone
+		}
+	}
+	return ""
+}
+
+// probeClusterDNSDomain resolves kubernetes.default.svc and returns the search
+// domain the resolver appended to it.
+func probeClusterDNSDomain(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsProbeTimeout)
+	defer cancel()
+	cname, err := net.DefaultResolver.LookupCNAME(ctx, kubernetesSvcName)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", kubernetesSvcName, err)
+	}
+	domain, ok := strings.CutPrefix(strings.TrimSuffix(cname, "."), kubernetesSvcName+".")
+	if !ok || domain == "" {
+		return "", fmt.Errorf("%s resolved to %s without a cluster domain", kubernetesSvcName, cname)
+	}
+	return domain, nil
+}
+
+// discoverClusterDNSServiceIP returns the cluster IP of the cluster DNS service.
+func discoverClusterDNSServiceIP(ctx context.Context, clientset kubernetes.Interface) (string, error) {
+	for _, name := range dnsServiceNames {
+		svc, err := clientset.CoreV1().Services(dnsNamespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to get DNS service %s: %w", name, err)
+		}
+		return svc.Spec.ClusterIP, nil
+	}
+	return "", fmt.Errorf("no DNS service %v found in %s", dnsServiceNames, dnsNamespace)
+}
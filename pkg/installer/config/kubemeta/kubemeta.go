@@ -3,51 +3,54 @@ package kubemeta
 import (
 	"context"
 	"fmt"
-	"os"
 
+	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+)
+
+// MetadataKeys for returned map
+const (
+	KeyClusterDNSDomain    = "cluster_dns_domain"
+	KeyClusterDNSServiceIP = "cluster_dns_service_ip"
 )
 
 type Metadata struct {
-	KubeVersion      string
-	CACertPEM        string
-	Host             string
-	ClusterDNSDomain string
+	KubeVersion string `json:"kube_version"`
+	CACertPEM   string `json:"ca_cert_pem"`
+	Host        string `json:"host"`
+	// ClusterDNSDomain is the domain of the services, e.g. cluster.local.
+	ClusterDNSDomain string `json:"cluster_dns_domain"`
+	// ClusterDNSServiceIP is the cluster IP of the cluster DNS service.
+	ClusterDNSServiceIP string `json:"cluster_dns_service_ip"`
 }
 
-func Load(ctx context.Context) (*Metadata, error) {
-	restConfig, err := getRestConfig()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get kubeconfig: %w", err)
+func (m *Metadata) ToMap() map[string]string {
+	return map[string]string{
+		KeyClusterDNSDomain:    m.ClusterDNSDomain,
+		KeyClusterDNSServiceIP: m.ClusterDNSServiceIP,
 	}
+}
 
-	clientset, err := kubernetes.NewForConfig(restConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
-	}
-	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+// Load reads the metadata of the cluster the client is connected to, host is the
+// URL of its API server.
+func Load(ctx context.Context, clientset kubernetes.Interface, host string) (*Metadata, error) {
+	serverVersion, err := clientset.Discovery().ServerVersion()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create discovery client: %w", err)
+		return nil, fmt.Errorf("failed to get server version: %w", err)
 	}
 
-	serverVersion, err := discoveryClient.ServerVersion()
+	dnsDomain, err := discoverClusterDNSDomain(ctx, clientset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get server version: %w", err)
+		logrus.Warnf("Unable to discover the cluster DNS domain, using %s: %v", DefaultClusterDNSDomain, err)
+		dnsDomain = DefaultClusterDNSDomain
 	}
-
-	dnsDomain := "cluster.local" // default value, will override if kube-dns configmap is found
-	cm, err := clientset.CoreV1().ConfigMaps("kube-system").Get(ctx, "kube-dns", metav1.GetOptions{})
-	if err == nil {
-		if val, ok := cm.Data["stubDomains"]; ok && val != "" {
-			dnsDomain = val // optionally parse JSON if needed
-		}
+	dnsServiceIP, err := discoverClusterDNSServiceIP(ctx, clientset)
+	if err != nil {
+		logrus.Warnf("Unable to discover the cluster DNS service IP: %v", err)
 	}
 
-	caConfigMap, err := clientset.CoreV1().ConfigMaps("default").Get(context.Background(), "kube-root-ca.crt", metav1.GetOptions{})
+	caConfigMap, err := clientset.CoreV1().ConfigMaps("default").Get(ctx, "kube-root-ca.crt", metav1.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get kube-root-ca.crt configmap: %w", err)
 	}
@@ -56,33 +59,10 @@ func Load(ctx context.Context) (*Metadata, error) {
 	}
 
 	return &Metadata{
-		KubeVersion:      serverVersion.GitVersion,
-		CACertPEM:        caConfigMap.Data["ca.crt"],
-		Host:             restConfig.Host,
-		ClusterDNSDomain: dnsDomain,
+		KubeVersion:         serverVersion.GitVersion,
+		CACertPEM:           caConfigMap.Data["ca.crt"],
+		Host:                host,
+		ClusterDNSDomain:    dnsDomain,
+		ClusterDNSServiceIP: dnsServiceIP,
 	}, nil
 }
-
-func getRestConfig() (*rest.Config, error) {
-	// Try in-cluster config first
-	restConfig, err := rest.InClusterConfig()
-	if err == nil {
-		return restConfig, nil
-	}
-
-	// Fallback to kubeconfig
-	kubeconfig := os.Getenv("KUBECONFIG")
-	if kubeconfig == "" {
-		kubeconfig = clientcmd.RecommendedHomeFile
-	}
-
-	restConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
-		&clientcmd.ConfigOverrides{},
-	).ClientConfig()
-	if err != nil {
-		return nil, fmt.Errorf("failed to build rest config: %w", err)
-	}
-
-	return restConfig, nil
-}
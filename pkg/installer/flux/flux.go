@@ -0,0 +1,110 @@
+package flux
+
+import (
+	"fmt"
+
+	"github.com/moolen/flux-poc/pkg/apis/installer/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// Namespace is the namespace Flux is installed into.
+	Namespace = "flux-system"
+	// RootName is the name of the root OCIRepository and Kustomization.
+	RootName = "platform"
+
+	// pruneAnnotation must match applier.PruneAnnotation, it keeps the root
+	// objects when they are no longer rendered.
+	pruneAnnotation = "installer.flux-poc.io/prune"
+	pruneDisabled   = "disabled"
+
+	ociRepositoryAPIVersion = "source.toolkit.fluxcd.io/v1beta2"
+	kustomizationAPIVersion = "kustomize.toolkit.fluxcd.io/v1"
+)
+
+var (
+	OCIRepositoryGVK = schema.FromAPIVersionAndKind(ociRepositoryAPIVersion, "OCIRepository")
+	KustomizationGVK = schema.FromAPIVersionAndKind(kustomizationAPIVersion, "Kustomization")
+)
+
+// Render renders the OCIRepository pointing to the platform artifact and the root
+// Kustomization that applies it. Variables in the artifact are substituted from the
+// given ConfigMap, which must live in the Flux namespace.
+// Nothing is rendered if the source has no URL. Both objects are never pruned, as
+// deleting the root Kustomization would garbage collect every platform workload.
+func Render(source v1alpha1.FluxSource, substituteFrom string) ([]byte, error) {
+	if source.URL == "" {
+		return nil, nil
+	}
+
+	ref := map[string]interface{}{}
+	switch {
+	case source.Semver != "":
+		ref["semver"] = source.Semver
+	case source.Tag != "":
+		ref["tag"] = source.Tag
+	default:
+		ref["tag"] = "latest"
+	}
+
+	ociRepository := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": ociRepositoryAPIVersion,
+		"kind":       "OCIRepository",
+		"metadata": map[string]interface{}{
+			"name":      RootName,
+			"namespace": Namespace,
+			"annotations": map[string]interface{}{
+				pruneAnnotation: pruneDisabled,
+			},
+		},
+		"spec": map[string]interface{}{
+			"interval": source.Interval.Duration.String(),
+			"url":      source.URL,
+			"ref":      ref,
+			// authenticate with the IRSA role of the source-controller
+			"provider": "aws",
+		},
+	}}
+
+	kustomization := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": kustomizationAPIVersion,
+		"kind":       "Kustomization",
+		"metadata": map[string]interface{}{
+			"name":      RootName,
+			"namespace": Namespace,
+			"annotations": map[string]interface{}{
+				pruneAnnotation: pruneDisabled,
+			},
+		},
+		"spec": map[string]interface{}{
+			"interval": source.Interval.Duration.String(),
+			"sourceRef": map[string]interface{}{
+				"kind": "OCIRepository",
+				"name": RootName,
+			},
+			"path":  source.Path,
+			"prune": true,
+			"postBuild": map[string]interface{}{
+				"substituteFrom": []interface{}{
+					map[string]interface{}{
+						"kind": "ConfigMap",
+						"name": substituteFrom,
+					},
+				},
+			},
+		},
+	}}
+
+	var out []byte
+	for _, obj := range []*unstructured.Unstructured{ociRepository, kustomization} {
+		b, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", obj.GetKind(), err)
+		}
+		out = append(out, []byte("---\n")...)
+		out = append(out, b...)
+	}
+	return out, nil
+}
@@ -3,37 +3,141 @@ package installer
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/moolen/flux-poc/pkg/apis/installer/v1alpha1"
 	"github.com/moolen/flux-poc/pkg/installer/aws/irsa"
+	"github.com/moolen/flux-poc/pkg/installer/aws/podidentity"
+	"github.com/moolen/flux-poc/pkg/installer/config/awsmeta"
+	"github.com/moolen/flux-poc/pkg/installer/plan"
 )
 
 func (i *Installer) ReconcileInfrastructure() (bool, error) {
-	// reconcile IAM roles for service accounts (IRSA)
-	mgr, err := irsa.New(context.Background())
-	if err != nil {
+	if err := i.reconcileIRSA(nil); err != nil {
 		return false, err
 	}
+	return false, nil
+}
+
+// reconcileIRSA reconciles IAM roles for service accounts (IRSA) and the
+// EKS Pod Identity associations of roles using pod identity.
+// With a non-nil plan the changes are only recorded.
+func (i *Installer) reconcileIRSA(p *plan.Plan) error {
+	ctx := context.Background()
+	mgr := irsa.New(i.awsConfig.IAM, i.irsaOwner()).WithPlan(p).WithLegacyRoleScan(i.scanLegacyRoles)
+	podIdentityMgr := podidentity.New(i.awsConfig.EKS, i.irsaOwner()).WithPlan(p)
+
 	irsaConfig := i.IRSAConfig()
-	if err = mgr.Reconcile(context.Background(), irsaConfig); err != nil {
-		return false, fmt.Errorf("reconciling IRSA: %w", err)
+	if err := mgr.Reconcile(ctx, irsaConfig); err != nil {
+		return fmt.Errorf("reconciling IRSA: %w", err)
 	}
-	if err := mgr.GarbageCollect(context.Background(), irsaConfig); err != nil {
-		return false, fmt.Errorf("garbage collecting IRSA: %w", err)
+	i.roleARNs = mgr.RoleARNs()
+	associations, err := i.podIdentityAssociations(irsaConfig)
+	if err != nil {
+		return err
 	}
+	if err := podIdentityMgr.Reconcile(ctx, associations); err != nil {
+		return fmt.Errorf("reconciling pod identity associations: %w", err)
+	}
+	if err := podIdentityMgr.GarbageCollect(ctx, associations); err != nil {
+		return fmt.Errorf("garbage collecting pod identity associations: %w", err)
+	}
+	if err := mgr.GarbageCollect(ctx, irsaConfig); err != nil {
+		return fmt.Errorf("garbage collecting IRSA: %w", err)
+	}
+	return nil
+}
 
-	return false, nil
+// podIdentityAssociations returns an association per service account of the roles using pod identity.
+func (i *Installer) podIdentityAssociations(roles []irsa.IRSAConfig) ([]podidentity.Association, error) {
+	var associations []podidentity.Association
+	for _, role := range roles {
+		if !role.PodIdentity {
+			continue
+		}
+		roleArn, err := i.roleARN(role)
+		if err != nil {
+			return nil, err
+		}
+		for _, sa := range role.ServiceAccounts {
+			namespace, name, _ := strings.Cut(sa, ":")
+			associations = append(associations, podidentity.Association{
+				Namespace:      namespace,
+				ServiceAccount: name,
+				RoleArn:        roleArn,
+			})
+		}
+	}
+	return associations, nil
+}
+
+// roleARN returns the ARN of the role as found by ReconcileInfrastructure, roles that were
+// not reconciled yet are expected under the owner path.
+func (i *Installer) roleARN(role irsa.IRSAConfig) (string, error) {
+	if roleArn, ok := i.roleARNs[role.RoleName]; ok {
+		return roleArn, nil
+	}
+	return i.irsaOwner().RoleARN(role)
+}
+
+// irsaOwner identifies the IAM roles owned by this installation.
+func (i *Installer) irsaOwner() irsa.Owner {
+	return irsa.Owner{
+		ClusterName: i.context.AWSMeta.ClusterName,
+		InstanceID:  i.context.Spec.InstanceID,
+	}
 }
 
 func (i *Installer) IRSAConfig() []irsa.IRSAConfig {
-	return []irsa.IRSAConfig{
-		{
-			RoleName: fmt.Sprintf("%s-flux-source-controller", i.context.AWSMeta.ClusterName),
-			PolicyArns: []string{
-				"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly",
-			},
-			OIDCProviderArn: i.context.AWSMeta.OIDCProviderARN,
-			ServiceAccount:  "flux-system:source-controller",
-			Audience:        "sts.amazonaws.com",
-		},
+	var roles []irsa.IRSAConfig
+	for _, role := range i.context.Spec.IRSA {
+		cfg := irsa.IRSAConfig{
+			RoleName:            fmt.Sprintf("%s-%s", i.context.AWSMeta.ClusterName, role.Name),
+			PolicyArns:          renderAll(role.PolicyARNs, i.context.AWSMeta),
+			InlinePolicies:      map[string]string{},
+			OIDCProviderArns:    append([]string{i.context.AWSMeta.OIDCProviderARN}, role.AdditionalOIDCProviderARNs...),
+			ServiceAccounts:     role.ServiceAccounts,
+			Audiences:           role.Audiences,
+			Path:                role.Path,
+			PermissionsBoundary: irsa.RenderPolicy(role.PermissionsBoundary, i.context.AWSMeta),
+			Description:         role.Description,
+			Tags:                role.Tags,
+			PodIdentity:         role.Mode == v1alpha1.IdentityModePodIdentity,
+			Partition:           i.context.AWSMeta.Partition,
+			AccountID:           i.context.AWSMeta.IAMAccountID,
+		}
+		if role.ServiceAccount != "" {
+			cfg.ServiceAccounts = append([]string{role.ServiceAccount}, cfg.ServiceAccounts...)
+		}
+		if role.Audience != "" {
+			cfg.Audiences = append([]string{role.Audience}, cfg.Audiences...)
+		}
+		if role.MaxSessionDuration != nil {
+			cfg.MaxSessionDuration = int32(role.MaxSessionDuration.Seconds())
+		}
+		if role.InlinePolicyName != "" {
+			cfg.InlinePolicies[role.InlinePolicyName] = irsa.RenderPolicy(role.InlinePolicy, i.context.AWSMeta)
+		}
+		for name, doc := range role.InlinePolicies {
+			cfg.InlinePolicies[name] = irsa.RenderPolicy(doc, i.context.AWSMeta)
+		}
+		for _, policy := range role.Policies {
+			cfg.Policies = append(cfg.Policies, irsa.Policy{
+				Name:        policy.Name,
+				Document:    irsa.RenderPolicy(policy.Document, i.context.AWSMeta),
+				Description: policy.Description,
+			})
+		}
+		roles = append(roles, cfg)
+	}
+	return roles
+}
+
+// renderAll renders the variables of every policy ARN.
+func renderAll(arns []string, meta *awsmeta.Metadata) []string {
+	var rendered []string
+	for _, arn := range arns {
+		rendered = append(rendered, irsa.RenderPolicy(arn, meta))
 	}
+	return rendered
 }
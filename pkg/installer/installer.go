@@ -3,6 +3,8 @@ package installer
 import (
 	"fmt"
 
+	"github.com/moolen/flux-poc/pkg/apis/installer/v1alpha1"
+	"github.com/moolen/flux-poc/pkg/installer/aws/awsconfig"
 	"github.com/moolen/flux-poc/pkg/installer/config/awsmeta"
 	"github.com/moolen/flux-poc/pkg/installer/config/kubemeta"
 	"github.com/moolen/flux-poc/pkg/installer/kustomize"
@@ -12,21 +14,77 @@ import (
 type Installer struct {
 	kubeClient      *kubernetes.Clientset
 	kustomizeRender *kustomize.Renderer
-	context         InstallerContext
+	awsOptions      awsconfig.Options
+	awsConfig       *awsconfig.Config
+	awsmetaOptions  awsmeta.Options
+	metadataFile    string
+	// scanLegacyRoles makes IRSA garbage collection list all roles under "/".
+	scanLegacyRoles bool
+	// roleARNs of the existing IRSA roles by role name, set by ReconcileInfrastructure.
+	roleARNs map[string]string
+	context  InstallerContext
 }
 
+// InstallerContext is discovered once by Prepare and consumed by every phase.
 type InstallerContext struct {
 	AWSMeta  *awsmeta.Metadata
 	KubeMeta *kubemeta.Metadata
+	// Spec is the defaulted and validated installation spec.
+	Spec v1alpha1.InstallationSpec
 }
 
 func New() *Installer {
+	spec := v1alpha1.InstallationSpec{}
+	v1alpha1.SetDefaults(&spec)
 	return &Installer{
 		kustomizeRender: kustomize.NewRenderer(),
-		context:         InstallerContext{},
+		context: InstallerContext{
+			Spec: spec,
+		},
 	}
 }
 
+// WithSpec replaces the default installation spec.
+// The spec is expected to be defaulted and validated already.
+func (i *Installer) WithSpec(spec v1alpha1.InstallationSpec) *Installer {
+	i.context.Spec = spec
+	return i
+}
+
+// WithAWSOptions sets how the AWS credentials are resolved. The assume role
+// chains of the spec are appended to the chains of the options.
+func (i *Installer) WithAWSOptions(opts awsconfig.Options) *Installer {
+	i.awsOptions = opts
+	return i
+}
+
+// WithClusterName skips the discovery of the EKS cluster name.
+func (i *Installer) WithClusterName(name string) *Installer {
+	i.awsmetaOptions.ClusterName = name
+	return i
+}
+
+// WithMetadataFile replays the discovered metadata from the file instead of
+// discovering the environment. The file is written after discovery if it does not exist.
+func (i *Installer) WithMetadataFile(path string) *Installer {
+	i.metadataFile = path
+	return i
+}
+
+// WithLegacyRoleScan makes IRSA garbage collection and uninstall list all roles
+// directly under "/", see irsa.Manager.WithLegacyRoleScan.
+func (i *Installer) WithLegacyRoleScan(enabled bool) *Installer {
+	i.scanLegacyRoles = enabled
+	return i
+}
+
+// WithAWSConfig injects the AWS config shared by all AWS clients,
+// the AWS options and the assume role chains of the spec are ignored.
+func (i *Installer) WithAWSConfig(cfg *awsconfig.Config) *Installer {
+	i.awsConfig = cfg
+	return i
+}
+
 func (i *Installer) WithCACert(secretName string) *Installer {
 	i.kustomizeRender.AddPatch(fmt.Sprintf(`
 apiVersion: apps/v1
@@ -18,6 +18,9 @@ import (
 
 type Patch struct {
 	PatchYAML string
+	// Target selects the objects the patch applies to. A patch with a target
+	// that matches no object is ignored, without a target it must match an object.
+	Target *types.Selector
 }
 
 // Renderer represents a renderer with optional patches and an image registry override.
@@ -47,7 +50,8 @@ func (r *Renderer) WithImageRegistry(registry string) *Renderer {
 }
 
 // Render renders the kustomize manifests with optional patches and image registry overrides.
-func (r *Renderer) Render(target fs.FS) ([]byte, error) {
+// The given patches are applied after the patches added to the renderer.
+func (r *Renderer) Render(target fs.FS, patches ...Patch) ([]byte, error) {
 	tmpDir := filepath.Join(os.TempDir(), "fluxkustomizer-"+uuid.New().String())
 	if err := os.MkdirAll(tmpDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create temp dir: %w", err)
@@ -81,7 +85,7 @@ func (r *Renderer) Render(target fs.FS) ([]byte, error) {
 	r.replaceImageRegistry(kustomization, uniqueImages)
 
 	// Apply patches.
-	for i, patch := range r.patches {
+	for i, patch := range append(append([]Patch{}, r.patches...), patches...) {
 		patchFilename := fmt.Sprintf("custom-patch-%d.yaml", i)
 		patchPath := filepath.Join(tmpDir, patchFilename)
 
@@ -90,7 +94,8 @@ func (r *Renderer) Render(target fs.FS) ([]byte, error) {
 		}
 
 		kustomization.Patches = append(kustomization.Patches, types.Patch{
-			Path: patchFilename,
+			Path:   patchFilename,
+			Target: patch.Target,
 		})
 	}
 
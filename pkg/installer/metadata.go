@@ -0,0 +1,52 @@
+package installer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/moolen/flux-poc/pkg/installer/config/awsmeta"
+	"github.com/moolen/flux-poc/pkg/installer/config/kubemeta"
+)
+
+// metadataSnapshot is the on-disk format of the discovered metadata. The spec is
+// not part of it, it is read from the config file on every run.
+type metadataSnapshot struct {
+	AWS  *awsmeta.Metadata  `json:"aws"`
+	Kube *kubemeta.Metadata `json:"kube"`
+}
+
+// readMetadataFile returns the snapshot of the file, or nil if it does not exist.
+func readMetadataFile(path string) (*metadataSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata file: %w", err)
+	}
+	var snapshot metadataSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata file %s: %w", path, err)
+	}
+	if snapshot.AWS == nil || snapshot.Kube == nil {
+		return nil, fmt.Errorf("metadata file %s is incomplete, run discover again", path)
+	}
+	return &snapshot, nil
+}
+
+func writeMetadataFile(path string, ctx InstallerContext) error {
+	data, err := json.MarshalIndent(metadataSnapshot{
+		AWS:  ctx.AWSMeta,
+		Kube: ctx.KubeMeta,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write metadata file: %w", err)
+	}
+	return nil
+}
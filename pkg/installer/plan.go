@@ -0,0 +1,18 @@
+package installer
+
+import (
+	"github.com/moolen/flux-poc/pkg/installer/plan"
+)
+
+// Plan returns the changes ReconcileInfrastructure and ReconcilePlatform would make
+// to IAM and Vault without executing them.
+func (i *Installer) Plan() (*plan.Plan, error) {
+	p := &plan.Plan{}
+	if err := i.reconcileIRSA(p); err != nil {
+		return nil, err
+	}
+	if err := i.reconcileVault(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
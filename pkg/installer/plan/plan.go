@@ -0,0 +1,106 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Action types recorded by the infrastructure and platform reconcilers.
+const (
+	CreateRole         = "CreateRole"
+	UpdateTrustPolicy  = "UpdateTrustPolicy"
+	TagRole            = "TagRole"
+	UntagRole          = "UntagRole"
+	AttachPolicy       = "AttachPolicy"
+	DetachPolicy       = "DetachPolicy"
+	PutInlinePolicy    = "PutInlinePolicy"
+	DeleteInlinePolicy = "DeleteInlinePolicy"
+	DeleteRole         = "DeleteRole"
+
+	CreatePolicy        = "CreatePolicy"
+	CreatePolicyVersion = "CreatePolicyVersion"
+	DeletePolicyVersion = "DeletePolicyVersion"
+
+	UpdateRole                = "UpdateRole"
+	PutPermissionsBoundary    = "PutPermissionsBoundary"
+	DeletePermissionsBoundary = "DeletePermissionsBoundary"
+	RemoveFromInstanceProfile = "RemoveFromInstanceProfile"
+
+	CreatePodIdentityAssociation = "CreatePodIdentityAssociation"
+	UpdatePodIdentityAssociation = "UpdatePodIdentityAssociation"
+	DeletePodIdentityAssociation = "DeletePodIdentityAssociation"
+
+	EnableAuth      = "EnableAuth"
+	DisableAuth     = "DisableAuth"
+	WriteAuthConfig = "WriteAuthConfig"
+	WriteRole       = "WriteRole"
+	WritePolicy     = "WritePolicy"
+	DeletePolicy    = "DeletePolicy"
+	MountEngine     = "MountEngine"
+	UnmountEngine   = "UnmountEngine"
+
+	SuspendObject = "SuspendObject"
+	DeleteObject  = "DeleteObject"
+)
+
+// Resource types an action applies to.
+const (
+	ResourceIAMRole     = "iam-role"
+	ResourceIAMPolicy   = "iam-policy"
+	ResourcePodIdentity = "eks-pod-identity-association"
+	ResourceVaultAuth   = "vault-auth"
+	ResourceVaultRole   = "vault-role"
+	ResourceVaultPolicy = "vault-policy"
+	ResourceVaultMount  = "vault-mount"
+	ResourceKubernetes  = "kubernetes"
+)
+
+// Action is a single change a reconciler intends to make.
+type Action struct {
+	Type     string `json:"type"`
+	Resource string `json:"resource"`
+	Name     string `json:"name"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// Plan collects the actions of the reconcilers instead of executing them.
+// A nil *Plan executes every action immediately.
+type Plan struct {
+	Actions []Action `json:"actions"`
+}
+
+// Do records the action if p is non-nil, otherwise fn is executed.
+func (p *Plan) Do(action Action, fn func() error) error {
+	if p == nil {
+		return fn()
+	}
+	p.Actions = append(p.Actions, action)
+	return nil
+}
+
+// WriteText writes the plan as a table.
+func (p *Plan) WriteText(w io.Writer) error {
+	if len(p.Actions) == 0 {
+		_, err := fmt.Fprintln(w, "No changes.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tRESOURCE\tNAME\tDETAIL")
+	for _, a := range p.Actions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", a.Type, a.Resource, a.Name, a.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nPlan: %d actions\n", len(p.Actions))
+	return err
+}
+
+// WriteJSON writes the plan as JSON.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
@@ -4,41 +4,35 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/moolen/flux-poc/pkg/installer/plan"
 	"github.com/moolen/flux-poc/pkg/installer/vault"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	vaultKubernetesMountPath = "kubernetes"
+	// defaultVaultAddress is the vault service in the vault namespace,
+	// formatted with the cluster DNS domain.
+	defaultVaultAddress = "http://vault.vault.svc.%s.:8200"
+)
+
 func (i *Installer) ReconcilePlatform() error {
 
-	if err := i.reconcileVault(); err != nil {
+	if err := i.reconcileVault(nil); err != nil {
 		return fmt.Errorf("reconciling vault: %w", err)
 	}
 	return nil
 }
 
-func (i *Installer) reconcileVault() error {
-	// we expect vault address to be static and
-	// vault root token to be available in a Kubernetes secret
-	// TODO: discover vault CA cert
-	vaultAddr := "http://vault.vault.svc.cluster.local.:8200"
-	token, err := i.getVaultToken()
-	if err != nil {
-		return fmt.Errorf("getting vault token: %w", err)
-	}
-	vaultMgt, err := vault.New(vaultAddr, token)
+// reconcileVault reconciles Vault policies, the secret engine and Kubernetes auth.
+// With a non-nil plan the changes are only recorded.
+func (i *Installer) reconcileVault(p *plan.Plan) error {
+	vaultMgt, err := i.newVaultManager()
 	if err != nil {
-		return fmt.Errorf("creating vault manager: %w", err)
+		return err
 	}
-	if err = vaultMgt.ReconcilePolicies(context.Background(), []vault.VaultPolicy{
-		{
-			Name: "flux-system",
-			Policy: `
-path "secret/*" {
-  capabilities = ["read", "list"]
-}
-`,
-		},
-	}); err != nil {
+	vaultMgt.WithPlan(p)
+	if err = vaultMgt.ReconcilePolicies(context.Background(), i.getVaultPolicies()); err != nil {
 		return fmt.Errorf("unable to reconcile roles: %w", err)
 	}
 
@@ -47,28 +41,65 @@ path "secret/*" {
 	}
 
 	if err := vaultMgt.Reconcile(context.Background(), vault.KubernetesAuthConfig{
-		MountPath:     "kubernetes",
+		MountPath:     vaultKubernetesMountPath,
 		KubeHost:      i.context.KubeMeta.Host,
 		KubeCA:        i.context.KubeMeta.CACertPEM,
 		TokenReviewer: "vault-token-reviewer",
-		Roles:         getKubernetesVaultRoles(),
+		Roles:         i.getKubernetesVaultRoles(),
 	}); err != nil {
 		return fmt.Errorf("reconciling vault: %w", err)
 	}
 	return nil
 }
 
-func getKubernetesVaultRoles() []vault.VaultKubeRole {
-	return []vault.VaultKubeRole{
-		{
-			Name:                          "flux-system",
-			BoundServiceAccountNames:      []string{"flux-system"},
-			BoundServiceAccountNamespaces: []string{"flux-system"},
-			Policies:                      []string{"flux-system"},
-			TTL:                           "1h",
-			Period:                        "30m",
-		},
+func (i *Installer) newVaultManager() (*vault.Manager, error) {
+	// we expect the vault root token to be available in a Kubernetes secret
+	// TODO: discover vault CA cert
+	vaultAddr := i.vaultAddress()
+	token, err := i.getVaultToken()
+	if err != nil {
+		return nil, fmt.Errorf("getting vault token: %w", err)
+	}
+	vaultMgt, err := vault.New(vaultAddr, token)
+	if err != nil {
+		return nil, fmt.Errorf("creating vault manager: %w", err)
+	}
+	return vaultMgt, nil
+}
+
+// vaultAddress returns the configured Vault address, or the in-cluster address
+// using the discovered cluster DNS domain.
+func (i *Installer) vaultAddress() string {
+	if i.context.Spec.Vault.Address != "" {
+		return i.context.Spec.Vault.Address
+	}
+	return fmt.Sprintf(defaultVaultAddress, i.context.KubeMeta.ClusterDNSDomain)
+}
+
+func (i *Installer) getVaultPolicies() []vault.VaultPolicy {
+	var policies []vault.VaultPolicy
+	for _, policy := range i.context.Spec.Vault.Policies {
+		policies = append(policies, vault.VaultPolicy{
+			Name:   policy.Name,
+			Policy: policy.Policy,
+		})
+	}
+	return policies
+}
+
+func (i *Installer) getKubernetesVaultRoles() []vault.VaultKubeRole {
+	var roles []vault.VaultKubeRole
+	for _, role := range i.context.Spec.Vault.Roles {
+		roles = append(roles, vault.VaultKubeRole{
+			Name:                          role.Name,
+			BoundServiceAccountNames:      role.ServiceAccountNames,
+			BoundServiceAccountNamespaces: role.ServiceAccountNamespaces,
+			Policies:                      role.Policies,
+			TTL:                           role.TTL,
+			Period:                        role.Period,
+		})
 	}
+	return roles
 }
 
 func (i *Installer) getVaultToken() (string, error) {
@@ -2,13 +2,61 @@ package installer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 
+	"github.com/moolen/flux-poc/pkg/apis/installer/v1alpha1"
+	"github.com/moolen/flux-poc/pkg/installer/aws/awsconfig"
 	"github.com/moolen/flux-poc/pkg/installer/config/awsmeta"
 	"github.com/moolen/flux-poc/pkg/installer/config/kubemeta"
+	"github.com/sirupsen/logrus"
 )
 
+// Prepare creates the Kubernetes and AWS clients and fills the installer context.
+// The metadata snapshot is replayed if it exists and describes the connected cluster,
+// otherwise the environment is discovered and the snapshot is written.
 func (i *Installer) Prepare() error {
+	if err := i.connect(); err != nil {
+		return err
+	}
+	replayed, err := i.replayMetadata()
+	if err != nil {
+		return err
+	}
+	if replayed {
+		return i.checkMetadata()
+	}
+	return i.discover()
+}
+
+// Discover creates the clients and discovers the environment, an existing
+// metadata snapshot is overwritten.
+func (i *Installer) Discover() error {
+	if err := i.connect(); err != nil {
+		return err
+	}
+	return i.discover()
+}
+
+// PrepareOffline fills the installer context from the metadata snapshot without
+// accessing the cluster or AWS. Only the manifests can be rendered afterwards.
+func (i *Installer) PrepareOffline() error {
+	if i.metadataFile == "" {
+		return errors.New("a metadata file is required to run offline")
+	}
+	replayed, err := i.replayMetadata()
+	if err != nil {
+		return err
+	}
+	if !replayed {
+		return fmt.Errorf("metadata file %s not found, run discover first", i.metadataFile)
+	}
+	return nil
+}
+
+func (i *Installer) connect() error {
 	var err error
 
 	cl, err := getKubeClient()
@@ -17,13 +65,101 @@ func (i *Installer) Prepare() error {
 	}
 	i.kubeClient = cl
 
-	i.context.AWSMeta, err = awsmeta.Load()
+	if i.awsConfig == nil {
+		opts := i.awsOptions
+		opts.AssumeRoles = append(opts.AssumeRoles, assumeRoles(i.context.Spec.AWS.AssumeRoles)...)
+		opts.IAMAssumeRoles = append(opts.IAMAssumeRoles, assumeRoles(i.context.Spec.AWS.IAMAssumeRoles)...)
+		i.awsConfig, err = awsconfig.Load(context.Background(), opts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discover loads the AWS and Kubernetes metadata and writes the snapshot, if configured.
+func (i *Installer) discover() error {
+	restConfig, err := getKubeConfig()
+	if err != nil {
+		return err
+	}
+	i.awsmetaOptions.APIServer = restConfig.Host
+	i.awsmetaOptions.Kubeconfig, err = getRawKubeConfig()
+	if err != nil {
+		return err
+	}
+
+	i.context.AWSMeta, err = awsmeta.Load(context.Background(), i.awsConfig, i.awsmetaOptions)
 	if err != nil {
 		return fmt.Errorf("failed to get AWS metadata: %w", err)
 	}
-	i.context.KubeMeta, err = kubemeta.Load(context.Background())
+	i.context.KubeMeta, err = kubemeta.Load(context.Background(), i.kubeClient, restConfig.Host)
 	if err != nil {
 		return fmt.Errorf("failed to load Kubernetes metadata: %w", err)
 	}
+	if i.metadataFile == "" {
+		return nil
+	}
+	logrus.Debugf("Writing metadata snapshot to %s", i.metadataFile)
+	return writeMetadataFile(i.metadataFile, i.context)
+}
+
+// replayMetadata fills the installer context from the metadata snapshot.
+// It returns false if no snapshot is configured or the file does not exist yet.
+func (i *Installer) replayMetadata() (bool, error) {
+	if i.metadataFile == "" {
+		return false, nil
+	}
+	snapshot, err := readMetadataFile(i.metadataFile)
+	if err != nil || snapshot == nil {
+		return false, err
+	}
+	logrus.Debugf("Using metadata snapshot %s of cluster %s", i.metadataFile, snapshot.AWS.ClusterName)
+	i.context.AWSMeta = snapshot.AWS
+	i.context.KubeMeta = snapshot.Kube
+	return true, nil
+}
+
+// checkMetadata verifies that the replayed snapshot describes the cluster the clients
+// are connected to, so that a stale snapshot never drives changes to another cluster.
+func (i *Installer) checkMetadata() error {
+	restConfig, err := getKubeConfig()
+	if err != nil {
+		return err
+	}
+	if !sameHost(i.context.KubeMeta.Host, restConfig.Host) {
+		return fmt.Errorf("metadata file %s describes API server %s, but connected to %s", i.metadataFile, i.context.KubeMeta.Host, restConfig.Host)
+	}
+	if name := i.awsmetaOptions.ClusterName; name != "" && name != i.context.AWSMeta.ClusterName {
+		return fmt.Errorf("metadata file %s describes cluster %s, but cluster %s is configured", i.metadataFile, i.context.AWSMeta.ClusterName, name)
+	}
+	if region := i.awsConfig.EKS.Region; region != i.context.AWSMeta.Region {
+		return fmt.Errorf("metadata file %s describes region %s, but the AWS config uses %s", i.metadataFile, i.context.AWSMeta.Region, region)
+	}
 	return nil
 }
+
+// sameHost reports whether two API server URLs point to the same host.
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Host, ub.Host)
+}
+
+func assumeRoles(roles []v1alpha1.AWSAssumeRole) []awsconfig.AssumeRole {
+	var chain []awsconfig.AssumeRole
+	for _, role := range roles {
+		chain = append(chain, awsconfig.AssumeRole{
+			RoleARN:     role.RoleARN,
+			ExternalID:  role.ExternalID,
+			SessionName: role.SessionName,
+		})
+	}
+	return chain
+}
@@ -6,48 +6,24 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/moolen/flux-poc/pkg/installer/config/awsmeta"
+	"github.com/moolen/flux-poc/pkg/apis/installer/v1alpha1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
-const minVersion = "1.32.0"
-
-type NodeGroupRequirement struct {
-	Name         string
-	CPU          int64
-	MemoryGB     int64
-	Architecture string
-}
-
-var requiredNodeGroups = []NodeGroupRequirement{
-	{"cockroachdb", 4, 16, "amd64"},
-	{"nats", 4, 16, "amd64"},
-	{"general", 8, 16, "amd64"},
-}
-
-var supportedRegions = []string{
-	"eu-west-1",
-	"eu-west-2",
-}
-
 func (i *Installer) CheckPrerequisites() error {
 	var validationErrs []error
 
 	// TODO:
-	// check supported region
 	// correct VPC networking requirements are met?
 	// - NAT gateway needed? public internet access needed?
 	// check storageclass is configured
 	// check metrics server is installed?
 
 	ctx := context.Background()
-	clientset, err := getKubeClient()
-	if err != nil {
-		return fmt.Errorf("failed to get Kubernetes client: %w", err)
-	}
+	clientset := i.kubeClient
 
-	if err := checkKubernetesVersion(clientset); err != nil {
+	if err := checkKubernetesVersion(i.context.KubeMeta.KubeVersion, i.context.Spec.MinKubernetesVersion); err != nil {
 		validationErrs = append(validationErrs, fmt.Errorf("cluster version is not compatible: %w", err))
 	}
 
@@ -55,18 +31,18 @@ func (i *Installer) CheckPrerequisites() error {
 		validationErrs = append(validationErrs, fmt.Errorf("IRSA (IAM Roles for Service Accounts) is not enabled: %w", err))
 	}
 
-	if err := validateNodeGroups(ctx, clientset); err != nil {
+	if err := checkRegion(i.context.AWSMeta.Region, i.context.Spec.Regions); err != nil {
+		validationErrs = append(validationErrs, fmt.Errorf("region validation failed: %w", err))
+	}
+
+	if err := validateNodeGroups(ctx, clientset, i.context.Spec.NodeGroups); err != nil {
 		validationErrs = append(validationErrs, fmt.Errorf("node group validation failed: %w", err))
 	}
 	return errors.Join(validationErrs...)
 }
 
-func checkKubernetesVersion(clientset *kubernetes.Clientset) error {
-	version, err := clientset.Discovery().ServerVersion()
-	if err != nil {
-		return err
-	}
-	return compareVersions(version.GitVersion[1:], minVersion)
+func checkKubernetesVersion(gitVersion, minVersion string) error {
+	return compareVersions(strings.TrimPrefix(gitVersion, "v"), minVersion)
 }
 
 func compareVersions(current, minimum string) error {
@@ -93,14 +69,13 @@ func checkIRSA(clientset *kubernetes.Clientset) error {
 	return errors.New("IRSA (IAM Roles for Service Accounts) not detected in aws-auth mapRoles")
 }
 
-func checkRegion() error {
-	region, err := awsmeta.GetRegion()
-	if err != nil {
-		return fmt.Errorf("failed to get AWS region: %w", err)
-	}
+func checkRegion(region string, supportedRegions []string) error {
 	if region == "" {
 		return errors.New("region not set or detected")
 	}
+	if len(supportedRegions) == 0 {
+		return nil
+	}
 	for _, r := range supportedRegions {
 		if r == region {
 			return nil
@@ -109,7 +84,7 @@ func checkRegion() error {
 	return fmt.Errorf("region %q is not supported, supported regions are: %v", region, supportedRegions)
 }
 
-func validateNodeGroups(ctx context.Context, clientset *kubernetes.Clientset) error {
+func validateNodeGroups(ctx context.Context, clientset *kubernetes.Clientset, requiredNodeGroups []v1alpha1.NodeGroupRequirement) error {
 	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return err
@@ -0,0 +1,164 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/moolen/flux-poc/pkg/installer/applier"
+	"github.com/moolen/flux-poc/pkg/installer/kustomize"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	kusttypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+)
+
+const (
+	// roleARNAnnotation tells the EKS pod identity webhook which role to inject into
+	// the pods of a service account.
+	roleARNAnnotation = "eks.amazonaws.com/role-arn"
+	// restartedAtAnnotation is set on the pod template to restart a Deployment,
+	// like kubectl rollout restart does.
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	// serviceAccountFieldManager owns the role ARN annotation of service accounts
+	// that are not part of the bootstrap manifests.
+	serviceAccountFieldManager = "flux-poc-irsa"
+)
+
+// serviceAccountRoleARNs returns the role ARN of every service account of an IRSA role.
+// Service account patterns and roles using pod identity need no annotation and are skipped.
+func (i *Installer) serviceAccountRoleARNs() (map[types.NamespacedName]string, error) {
+	arns := map[types.NamespacedName]string{}
+	for _, role := range i.IRSAConfig() {
+		if role.PodIdentity {
+			continue
+		}
+		roleArn, err := i.roleARN(role)
+		if err != nil {
+			return nil, err
+		}
+		for _, sa := range role.ServiceAccounts {
+			if strings.ContainsAny(sa, "*?") {
+				continue
+			}
+			namespace, name, _ := strings.Cut(sa, ":")
+			arns[types.NamespacedName{Namespace: namespace, Name: name}] = roleArn
+		}
+	}
+	return arns, nil
+}
+
+// serviceAccountPatches annotates the service accounts of the bootstrap manifests
+// with their role ARN. Patches for service accounts that are not part of the
+// manifests match no object and are ignored.
+func serviceAccountPatches(arns map[types.NamespacedName]string) []kustomize.Patch {
+	keys := make([]types.NamespacedName, 0, len(arns))
+	for key := range arns {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool { return keys[a].String() < keys[b].String() })
+
+	var patches []kustomize.Patch
+	for _, key := range keys {
+		patches = append(patches, kustomize.Patch{
+			PatchYAML: fmt.Sprintf(`
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: %s
+  namespace: %s
+  annotations:
+    %s: %s
+`, key.Name, key.Namespace, roleARNAnnotation, arns[key]),
+			Target: &kusttypes.Selector{
+				ResId: resid.ResId{
+					Gvk:       resid.Gvk{Version: "v1", Kind: "ServiceAccount"},
+					Name:      key.Name,
+					Namespace: key.Namespace,
+				},
+			},
+		})
+	}
+	return patches
+}
+
+// currentRoleARNs returns the role ARN annotation of the existing service accounts.
+// Service accounts that do not exist are omitted.
+func (i *Installer) currentRoleARNs(ctx context.Context, arns map[types.NamespacedName]string) (map[types.NamespacedName]string, error) {
+	current := map[types.NamespacedName]string{}
+	for key := range arns {
+		sa, err := i.kubeClient.CoreV1().ServiceAccounts(key.Namespace).Get(ctx, key.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get service account %s: %w", key, err)
+		}
+		current[key] = sa.Annotations[roleARNAnnotation]
+	}
+	return current, nil
+}
+
+// annotateServiceAccounts annotates the existing service accounts that are not part of
+// the applied bootstrap manifests with their role ARN. Service accounts that do not
+// exist yet, e.g. because Flux has not created them, are annotated on the next run.
+func (i *Installer) annotateServiceAccounts(ctx context.Context, arns, current map[types.NamespacedName]string, applied []applier.ObjectRef) error {
+	bundled := map[types.NamespacedName]struct{}{}
+	for _, ref := range applied {
+		if ref.Group == "" && ref.Kind == "ServiceAccount" {
+			bundled[types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}] = struct{}{}
+		}
+	}
+	for key, roleArn := range arns {
+		if _, ok := bundled[key]; ok {
+			continue
+		}
+		if _, ok := current[key]; !ok {
+			logrus.Infof("Service account %s does not exist yet, not annotating it", key)
+			continue
+		}
+		sa := corev1ac.ServiceAccount(key.Name, key.Namespace).
+			WithAnnotations(map[string]string{roleARNAnnotation: roleArn})
+		_, err := i.kubeClient.CoreV1().ServiceAccounts(key.Namespace).Apply(ctx, sa, metav1.ApplyOptions{
+			FieldManager: serviceAccountFieldManager,
+			Force:        true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to annotate service account %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// restartWorkloads restarts the Deployments running with a service account whose role
+// ARN changed, so that the new role is injected into their pods. Service accounts
+// that did not exist before have no pods to restart.
+func (i *Installer) restartWorkloads(ctx context.Context, arns, previous map[types.NamespacedName]string) error {
+	for key, roleArn := range arns {
+		before, existed := previous[key]
+		if !existed || before == roleArn {
+			continue
+		}
+		deployments, err := i.kubeClient.AppsV1().Deployments(key.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list deployments in %s: %w", key.Namespace, err)
+		}
+		for _, deploy := range deployments.Items {
+			if deploy.Spec.Template.Spec.ServiceAccountName != key.Name {
+				continue
+			}
+			logrus.Infof("Restarting deployment %s/%s as the role of service account %s changed", deploy.Namespace, deploy.Name, key.Name)
+			patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, restartedAtAnnotation, time.Now().Format(time.RFC3339))
+			_, err := i.kubeClient.AppsV1().Deployments(deploy.Namespace).Patch(ctx, deploy.Name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to restart deployment %s/%s: %w", deploy.Namespace, deploy.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moolen/flux-poc/pkg/installer/applier"
+	"github.com/moolen/flux-poc/pkg/installer/aws/irsa"
+	"github.com/moolen/flux-poc/pkg/installer/aws/podidentity"
+	"github.com/moolen/flux-poc/pkg/installer/flux"
+	"github.com/moolen/flux-poc/pkg/installer/plan"
+	"github.com/sirupsen/logrus"
+)
+
+type UninstallOptions struct {
+	// KeepCRDs keeps the CustomResourceDefinitions of the bootstrap manifests.
+	KeepCRDs bool
+	// Vault also removes the Kubernetes auth method and the policies from Vault.
+	Vault bool
+	// DryRun only records the changes in the returned plan.
+	DryRun bool
+}
+
+// Uninstall reverses an installation: it suspends and deletes the Flux root objects,
+// deletes the bootstrap manifests recorded in the inventory, the pod identity associations
+// and IRSA roles owned by this cluster and installer instance and optionally removes
+// the Vault configuration.
+// With DryRun set nothing is changed and the returned plan lists the intended actions.
+func (i *Installer) Uninstall(opts UninstallOptions) (*plan.Plan, error) {
+	ctx := context.Background()
+	var p *plan.Plan
+	if opts.DryRun {
+		p = &plan.Plan{}
+	}
+
+	a, err := newApplier()
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Debugf("Removing Flux root objects")
+	roots := []applier.ObjectRef{
+		{GroupVersionKind: flux.KustomizationGVK, Namespace: flux.Namespace, Name: flux.RootName},
+		{GroupVersionKind: flux.OCIRepositoryGVK, Namespace: flux.Namespace, Name: flux.RootName},
+	}
+	for _, ref := range roots {
+		if err := a.Suspend(ctx, ref, p); err != nil {
+			return nil, err
+		}
+	}
+	// the root objects are protected from pruning, not from uninstall
+	if err := a.ForceDelete(ctx, roots, p); err != nil {
+		return nil, fmt.Errorf("deleting Flux root objects: %w", err)
+	}
+
+	logrus.Debugf("Removing bootstrap manifests")
+	if err := a.DeleteInventory(ctx, opts.KeepCRDs, p); err != nil {
+		return nil, fmt.Errorf("deleting bootstrap manifests: %w", err)
+	}
+
+	logrus.Debugf("Removing pod identity associations")
+	if err := podidentity.New(i.awsConfig.EKS, i.irsaOwner()).WithPlan(p).DeleteAll(ctx); err != nil {
+		return nil, fmt.Errorf("deleting pod identity associations: %w", err)
+	}
+
+	logrus.Debugf("Removing IRSA roles")
+	irsaMgr := irsa.New(i.awsConfig.IAM, i.irsaOwner()).WithPlan(p).WithLegacyRoleScan(i.scanLegacyRoles)
+	if err := irsaMgr.DeleteAll(ctx, i.IRSAConfig()); err != nil {
+		return nil, fmt.Errorf("deleting IRSA roles: %w", err)
+	}
+
+	if opts.Vault {
+		logrus.Debugf("Removing Vault configuration")
+		vaultMgt, err := i.newVaultManager()
+		if err != nil {
+			return nil, err
+		}
+		if err := vaultMgt.WithPlan(p).Remove(ctx, vaultKubernetesMountPath, i.getVaultPolicies()); err != nil {
+			return nil, fmt.Errorf("removing vault configuration: %w", err)
+		}
+	}
+	return p, nil
+}
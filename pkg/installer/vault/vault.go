@@ -5,9 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	vault "github.com/hashicorp/vault/api"
+	"github.com/moolen/flux-poc/pkg/installer/plan"
 )
 
 type KubernetesAuthConfig struct {
@@ -35,6 +40,7 @@ type VaultPolicy struct {
 type Manager struct {
 	client *vault.Client
 	mount  string
+	plan   *plan.Plan
 }
 
 func New(vaultAddr, token string) (*Manager, error) {
@@ -48,6 +54,13 @@ func New(vaultAddr, token string) (*Manager, error) {
 	return &Manager{client: client}, nil
 }
 
+// WithPlan puts the manager into plan mode: all changes are recorded
+// in the plan instead of being executed.
+func (m *Manager) WithPlan(p *plan.Plan) *Manager {
+	m.plan = p
+	return m
+}
+
 func (m *Manager) Reconcile(ctx context.Context, cfg KubernetesAuthConfig) error {
 	m.mount = cfg.MountPath
 
@@ -57,7 +70,14 @@ func (m *Manager) Reconcile(ctx context.Context, cfg KubernetesAuthConfig) error
 		return fmt.Errorf("failed to list auth methods: %w", err)
 	}
 	if _, ok := auths[cfg.MountPath+"/"]; !ok {
-		err := m.client.Sys().EnableAuthWithOptions(cfg.MountPath, &vault.EnableAuthOptions{Type: "kubernetes"})
+		err := m.plan.Do(plan.Action{
+			Type:     plan.EnableAuth,
+			Resource: plan.ResourceVaultAuth,
+			Name:     cfg.MountPath,
+			Detail:   "kubernetes",
+		}, func() error {
+			return m.client.Sys().EnableAuthWithOptions(cfg.MountPath, &vault.EnableAuthOptions{Type: "kubernetes"})
+		})
 		if err != nil {
 			return fmt.Errorf("failed to enable kubernetes auth: %w", err)
 		}
@@ -74,8 +94,16 @@ func (m *Manager) Reconcile(ctx context.Context, cfg KubernetesAuthConfig) error
 		"kubernetes_ca_cert": cfg.KubeCA,
 		"token_reviewer_jwt": cfg.TokenReviewer,
 	}
-	if existing == nil || !equalMaps(input, existing.Data) {
-		_, err := m.client.Logical().Write(confPath, input)
+	if existing == nil || !desiredEqual(input, existing.Data) {
+		err := m.plan.Do(plan.Action{
+			Type:     plan.WriteAuthConfig,
+			Resource: plan.ResourceVaultAuth,
+			Name:     confPath,
+			Detail:   cfg.KubeHost,
+		}, func() error {
+			_, err := m.client.Logical().Write(confPath, input)
+			return err
+		})
 		if err != nil {
 			return fmt.Errorf("failed to write kubernetes config: %w", err)
 		}
@@ -95,8 +123,16 @@ func (m *Manager) Reconcile(ctx context.Context, cfg KubernetesAuthConfig) error
 		if err != nil && !isNotFound(err) {
 			return fmt.Errorf("failed to read existing role: %w", err)
 		}
-		if existing == nil || !equalMaps(desired, existing.Data) {
-			_, err := m.client.Logical().Write(rolePath, desired)
+		if existing == nil || !desiredEqual(desired, existing.Data) {
+			err := m.plan.Do(plan.Action{
+				Type:     plan.WriteRole,
+				Resource: plan.ResourceVaultRole,
+				Name:     rolePath,
+				Detail:   fmt.Sprintf("policies=%s", strings.Join(role.Policies, ",")),
+			}, func() error {
+				_, err := m.client.Logical().Write(rolePath, desired)
+				return err
+			})
 			if err != nil {
 				return fmt.Errorf("failed to write role %s: %w", role.Name, err)
 			}
@@ -112,7 +148,13 @@ func (m *Manager) ReconcilePolicies(ctx context.Context, policies []VaultPolicy)
 			return fmt.Errorf("failed to get policy %s: %w", policy.Name, err)
 		}
 		if existing != policy.Policy {
-			err := m.client.Sys().PutPolicy(policy.Name, policy.Policy)
+			err := m.plan.Do(plan.Action{
+				Type:     plan.WritePolicy,
+				Resource: plan.ResourceVaultPolicy,
+				Name:     policy.Name,
+			}, func() error {
+				return m.client.Sys().PutPolicy(policy.Name, policy.Policy)
+			})
 			if err != nil {
 				return fmt.Errorf("failed to write policy %s: %w", policy.Name, err)
 			}
@@ -135,7 +177,14 @@ func (m *Manager) ReconcileSecretEngine(ctx context.Context) error {
 			return nil // already configured correctly
 		}
 		// If wrong version or type, disable it before re-mounting
-		err := m.client.Sys().Unmount(mountPath)
+		err := m.plan.Do(plan.Action{
+			Type:     plan.UnmountEngine,
+			Resource: plan.ResourceVaultMount,
+			Name:     mountPath,
+			Detail:   fmt.Sprintf("type=%s version=%s", mount.Type, mount.Options["version"]),
+		}, func() error {
+			return m.client.Sys().Unmount(mountPath)
+		})
 		if err != nil {
 			return fmt.Errorf("failed to unmount existing secret engine: %w", err)
 		}
@@ -150,12 +199,63 @@ func (m *Manager) ReconcileSecretEngine(ctx context.Context) error {
 		Description: "KV v2 secrets engine for cluster",
 	}
 
-	if err := m.client.Sys().Mount(mountPath, opts); err != nil {
+	err = m.plan.Do(plan.Action{
+		Type:     plan.MountEngine,
+		Resource: plan.ResourceVaultMount,
+		Name:     mountPath,
+		Detail:   "type=kv version=2",
+	}, func() error {
+		return m.client.Sys().Mount(mountPath, opts)
+	})
+	if err != nil {
 		return fmt.Errorf("failed to mount kv v2 secret engine: %w", err)
 	}
 	return nil
 }
 
+// Remove disables the Kubernetes auth method, which also removes all of its roles,
+// and deletes the given policies.
+func (m *Manager) Remove(ctx context.Context, mountPath string, policies []VaultPolicy) error {
+	auths, err := m.client.Sys().ListAuth()
+	if err != nil {
+		return fmt.Errorf("failed to list auth methods: %w", err)
+	}
+	if _, ok := auths[mountPath+"/"]; ok {
+		err := m.plan.Do(plan.Action{
+			Type:     plan.DisableAuth,
+			Resource: plan.ResourceVaultAuth,
+			Name:     mountPath,
+			Detail:   "removes all roles of the auth method",
+		}, func() error {
+			return m.client.Sys().DisableAuth(mountPath)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to disable kubernetes auth: %w", err)
+		}
+	}
+
+	for _, policy := range policies {
+		existing, err := m.client.Sys().GetPolicy(policy.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get policy %s: %w", policy.Name, err)
+		}
+		if existing == "" {
+			continue
+		}
+		err = m.plan.Do(plan.Action{
+			Type:     plan.DeletePolicy,
+			Resource: plan.ResourceVaultPolicy,
+			Name:     policy.Name,
+		}, func() error {
+			return m.client.Sys().DeletePolicy(policy.Name)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete policy %s: %w", policy.Name, err)
+		}
+	}
+	return nil
+}
+
 func isNotFound(err error) bool {
 	if respErr, ok := err.(*vault.ResponseError); ok {
 		return respErr.StatusCode == http.StatusNotFound
@@ -163,8 +263,95 @@ func isNotFound(err error) bool {
 	return false
 }
 
-func equalMaps(a, b map[string]interface{}) bool {
-	aJSON, _ := json.Marshal(a)
-	bJSON, _ := json.Marshal(b)
-	return string(aJSON) == string(bJSON)
+var (
+	// durationKeys are written as duration strings and read back as seconds.
+	durationKeys = map[string]bool{"ttl": true, "period": true}
+	// listKeys are written as lists or comma separated strings and read back as lists.
+	listKeys = map[string]bool{
+		"bound_service_account_names":      true,
+		"bound_service_account_namespaces": true,
+		"policies":                         true,
+	}
+	// writeOnlyKeys are never returned, Vault only reports whether they are set.
+	writeOnlyKeys = map[string]string{"token_reviewer_jwt": "token_reviewer_jwt_set"}
+)
+
+// desiredEqual reports whether the keys of the desired config match the config read
+// from Vault. Keys only returned by Vault, e.g. defaults of other settings, are ignored.
+func desiredEqual(desired, existing map[string]interface{}) bool {
+	for key, want := range desired {
+		if setKey, ok := writeOnlyKeys[key]; ok {
+			isSet, _ := existing[setKey].(bool)
+			if isSet != (fmt.Sprint(want) != "") {
+				return false
+			}
+			continue
+		}
+		got, ok := existing[key]
+		if !ok {
+			return false
+		}
+		if !reflect.DeepEqual(normalizeValue(key, want), normalizeValue(key, got)) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeValue converts durations to seconds and lists to sorted string slices.
+func normalizeValue(key string, v interface{}) interface{} {
+	switch {
+	case durationKeys[key]:
+		return durationSeconds(v)
+	case listKeys[key]:
+		var list []string
+		switch val := v.(type) {
+		case []string:
+			list = append(list, val...)
+		case []interface{}:
+			for _, item := range val {
+				list = append(list, fmt.Sprint(item))
+			}
+		default:
+			list = strings.Split(fmt.Sprint(val), ",")
+		}
+		normalized := []string{}
+		for _, item := range list {
+			if item = strings.TrimSpace(item); item != "" {
+				normalized = append(normalized, item)
+			}
+		}
+		sort.Strings(normalized)
+		return normalized
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// durationSeconds returns the seconds of a duration string such as 1h or 3600,
+// or of a number of seconds as returned by Vault. Unparsable values are kept as is.
+func durationSeconds(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+	case float64:
+		return int64(val)
+	case int:
+		return int64(val)
+	case int64:
+		return val
+	case string:
+		if val == "" {
+			return int64(0)
+		}
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return n
+		}
+		if d, err := time.ParseDuration(val); err == nil {
+			return int64(d / time.Second)
+		}
+	}
+	return fmt.Sprint(v)
 }